@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/pipeline_service"
+	"edward-lemonade/chive/internal/project_service"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ExportProject downloads a project as a .chive archive. Pass samples=true to include the
+// project's sample images.
+func ExportProject(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+	if err := initializers.DB.Model(project).Association("Tags").Find(&project.Tags); err != nil {
+		fmt.Print("Failed to load tags: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export project"})
+		return
+	}
+
+	var samples []models.ProjectSample
+	if c.Query("samples") == "true" {
+		if err := initializers.DB.Where("project_id = ?", project.ID).Order("name").Find(&samples).Error; err != nil {
+			fmt.Print("Failed to load samples: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export project"})
+			return
+		}
+	}
+
+	archive, err := project_service.BuildArchive(project, currentUser.Username, samples)
+	if err != nil {
+		fmt.Print("Failed to build archive: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export project"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveFilename(project.Title)))
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// ImportProject recreates a project from a .chive archive uploaded in the multipart
+// "archive" field, as a new project owned by the current user
+func ImportProject(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	fileHeader, err := c.FormFile("archive")
+	if err != nil {
+		fmt.Print("No archive uploaded")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No archive uploaded"})
+		return
+	}
+	if fileHeader.Size > project_service.MaxArchiveSize {
+		fmt.Print("Archive too large")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Archive is over %d MB", project_service.MaxArchiveSize>>20)})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		fmt.Print("Failed to open archive: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		fmt.Print("Failed to read archive: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+
+	manifest, samples, err := project_service.ReadArchive(data)
+	if err != nil {
+		fmt.Print("Invalid archive: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags, err := project_service.NormalizeTags(manifest.Project.Tags)
+	if err != nil {
+		fmt.Print("Invalid archive: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", project_service.ErrInvalidArchive, err)})
+		return
+	}
+
+	// like a save, broken pipelines come in anyway and the editor is told what is wrong
+	diagnostics := pipeline_service.Validate(manifest.Data)
+
+	dataBytes, err := json.Marshal(manifest.Data)
+	if err != nil {
+		fmt.Print("Failed to marshal project data: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal project data"})
+		return
+	}
+
+	project := models.Project{
+		CreatorID:       currentUser.ID,
+		CreatorUsername: currentUser.Username,
+		Title:           strings.TrimSpace(manifest.Project.Title),
+		Description:     manifest.Project.Description,
+		Data:            datatypes.JSON(dataBytes),
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := project_service.SetProjectTags(tx, &project, tags); err != nil {
+				return err
+			}
+		}
+		for i := range samples {
+			samples[i].ProjectID = project.ID
+			if err := tx.Create(&samples[i]).Error; err != nil {
+				return err
+			}
+		}
+		message := fmt.Sprintf("Imported from %s", fileHeader.Filename)
+		if manifest.ExportedBy != "" {
+			message = fmt.Sprintf("Imported from %s, exported by %s", fileHeader.Filename, manifest.ExportedBy)
+		}
+		_, err := project_service.RecordVersion(tx, &project, currentUser, message, false)
+		return err
+	})
+	if err != nil {
+		fmt.Print("Failed to import project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Project imported successfully",
+		"project":     projectInfo(&project, models.RoleOwner),
+		"samples":     len(samples),
+		"diagnostics": diagnostics,
+	})
+}
+
+// archiveFilename makes a download name out of a project title
+func archiveFilename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, "_")
+	if name == "" {
+		name = "project"
+	}
+	return name + project_service.ArchiveExtension
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetFolders(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	var folders []models.Folder
+	if err := initializers.DB.Where("user_id = ?", currentUser.ID).Order("LOWER(name)").Find(&folders).Error; err != nil {
+		fmt.Print("Failed to fetch folders: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+	counts, err := project_service.FolderCounts(initializers.DB, currentUser.ID)
+	if err != nil {
+		fmt.Print("Failed to fetch folders: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		return
+	}
+
+	folderInfos := make([]models.FolderInfo, len(folders))
+	for i := range folders {
+		folderInfos[i] = folderInfo(&folders[i], counts[folders[i].ID])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"folders": folderInfos,
+	})
+}
+
+func CreateFolder(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	var input models.FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	name, err := project_service.NormalizeFolderName(input.Name)
+	if err != nil {
+		fmt.Print("Invalid folder name: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := project_service.CheckFolderName(initializers.DB, currentUser.ID, name, 0); err != nil {
+		folderError(c, err)
+		return
+	}
+
+	folder := models.Folder{
+		UserID: currentUser.ID,
+		Name:   name,
+	}
+	if err := initializers.DB.Create(&folder).Error; err != nil {
+		fmt.Print("Failed to create folder: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder created successfully",
+		"folder":  folderInfo(&folder, 0),
+	})
+}
+
+func RenameFolder(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	folder, ok := findFolder(c, currentUser, c.Param("folderId"))
+	if !ok {
+		return
+	}
+
+	var input models.FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	name, err := project_service.NormalizeFolderName(input.Name)
+	if err != nil {
+		fmt.Print("Invalid folder name: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := project_service.CheckFolderName(initializers.DB, currentUser.ID, name, folder.ID); err != nil {
+		folderError(c, err)
+		return
+	}
+
+	if err := initializers.DB.Model(folder).Update("name", name).Error; err != nil {
+		fmt.Print("Failed to rename folder: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename folder"})
+		return
+	}
+
+	counts, err := project_service.FolderCounts(initializers.DB, currentUser.ID)
+	if err != nil {
+		fmt.Print("Failed to count folder projects: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder renamed successfully",
+		"folder":  folderInfo(folder, counts[folder.ID]),
+	})
+}
+
+// DeleteFolder removes a folder. Its projects aren't deleted, they just end up in no folder.
+func DeleteFolder(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	folder, ok := findFolder(c, currentUser, c.Param("folderId"))
+	if !ok {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("folder_id = ?", folder.ID).Delete(&models.FolderProject{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(folder).Error
+	})
+	if err != nil {
+		fmt.Print("Failed to delete folder: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder deleted successfully",
+	})
+}
+
+// MoveProjectToFolder files a project into one of the current user's folders. Folders
+// are personal, so viewers can organize shared projects too.
+func MoveProjectToFolder(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	project, role, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var input models.ProjectFolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if input.FolderID != nil {
+		if _, err := project_service.FindFolder(initializers.DB, currentUser.ID, *input.FolderID); err != nil {
+			folderError(c, err)
+			return
+		}
+	}
+
+	if err := project_service.MoveToFolder(initializers.DB, currentUser.ID, project.ID, input.FolderID); err != nil {
+		fmt.Print("Failed to move project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move project"})
+		return
+	}
+
+	info := projectInfo(project, role)
+	info.FolderID = input.FolderID
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project moved successfully",
+		"project": info,
+	})
+}
+
+// GetTags lists the tags used on the current user's projects, for filtering the list
+func GetTags(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	tags, err := project_service.TagCounts(initializers.DB, currentUser.ID)
+	if err != nil {
+		fmt.Print("Failed to fetch tags: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags": tags,
+	})
+}
+
+// findFolder loads one of the current user's folders by its ID param
+func findFolder(c *gin.Context, currentUser models.User, param string) (*models.Folder, bool) {
+	var folderID uint
+	if _, err := fmt.Sscanf(param, "%d", &folderID); err != nil {
+		fmt.Print("Invalid folder ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+		return nil, false
+	}
+
+	folder, err := project_service.FindFolder(initializers.DB, currentUser.ID, folderID)
+	if err != nil {
+		folderError(c, err)
+		return nil, false
+	}
+	return folder, true
+}
+
+// folderError responds to an error from the folder helpers in project_service
+func folderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, project_service.ErrFolderNotFound):
+		fmt.Print("Folder not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+	case errors.Is(err, project_service.ErrFolderExists):
+		fmt.Print("Folder already exists")
+		c.JSON(http.StatusConflict, gin.H{"error": "A folder with that name already exists"})
+	default:
+		fmt.Print("Failed to look up folder: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up folder"})
+	}
+}
+
+func folderInfo(folder *models.Folder, projectCount int) models.FolderInfo {
+	return models.FolderInfo{
+		ID:           folder.ID,
+		Name:         folder.Name,
+		ProjectCount: projectCount,
+		CreatedAt:    folder.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:    folder.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
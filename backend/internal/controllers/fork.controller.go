@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/pipeline_service"
+	"edward-lemonade/chive/internal/project_service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// errUpToDate ends a pull transaction that has nothing to merge
+var errUpToDate = errors.New("fork is up to date")
+
+// GetProjectForks returns the whole fork tree a project belongs to, from its oldest
+// ancestor down. Projects the user can't open are still listed so the tree stays intact,
+// but without their title or creator.
+func GetProjectForks(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	root, err := project_service.ForkRoot(initializers.DB, project)
+	if err != nil {
+		fmt.Print("Failed to fetch forks: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch forks"})
+		return
+	}
+	descendants, err := project_service.ForkDescendants(initializers.DB, root.ID)
+	if err != nil {
+		fmt.Print("Failed to fetch forks: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch forks"})
+		return
+	}
+
+	all := append([]models.Project{*root}, descendants...)
+	roles, err := project_service.RolesFor(initializers.DB, all, currentUser.ID)
+	if err != nil {
+		fmt.Print("Failed to fetch forks: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch forks"})
+		return
+	}
+
+	forksOf := map[uint][]models.Project{}
+	for _, fork := range descendants {
+		forksOf[*fork.ParentID] = append(forksOf[*fork.ParentID], fork)
+	}
+	var build func(project models.Project) models.ForkNode
+	build = func(project models.Project) models.ForkNode {
+		node := models.ForkNode{
+			ID:            project.ID,
+			ParentVersion: project.ParentVersion,
+			Accessible:    roles[project.ID] != "" || project.Published,
+			Forks:         []models.ForkNode{},
+		}
+		if node.Accessible {
+			node.Title = project.Title
+			node.CreatorUsername = project.CreatorUsername
+		}
+		for _, fork := range forksOf[project.ID] {
+			node.Forks = append(node.Forks, build(fork))
+		}
+		return node
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"projectId": project.ID,
+		"tree":      build(*root),
+	})
+}
+
+// PullUpstream merges what changed in a fork's parent since the fork last synced into
+// the fork, saved as a new version. Changes the fork made to the same node fields or
+// params win and come back as conflicts.
+func PullUpstream(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	fork, role, ok := findProject(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+	if fork.ParentID == nil {
+		fmt.Print("Project is not a fork")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Project is not a fork"})
+		return
+	}
+
+	// The body is optional, without one the pull isn't checked against the editor's copy
+	var input models.ProjectPullInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			fmt.Print("Error binding JSON: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+			return
+		}
+	}
+
+	// published parents can be pulled from without a role on them
+	var parent models.Project
+	if err := initializers.DB.Where("id = ?", *fork.ParentID).First(&parent).Error; err != nil {
+		fmt.Print("Upstream project not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upstream project not found"})
+		return
+	}
+	parentRole, err := project_service.RoleFor(initializers.DB, &parent, currentUser.ID)
+	if err != nil {
+		fmt.Print("Failed to check upstream access: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pull upstream changes"})
+		return
+	}
+	if parentRole == "" && !parent.Published {
+		fmt.Print("Upstream project not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upstream project not found"})
+		return
+	}
+
+	var version *models.ProjectVersion
+	var latestVersion int
+	var upstreamVersion int
+	conflicts := []pipeline_service.MergeConflict{}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		current, latest, err := project_service.LockForSave(tx, fork.ID, input.BaseVersion, "")
+		if err != nil {
+			if current != nil {
+				fork, latestVersion = current, latest
+			}
+			return err
+		}
+		fork, latestVersion = current, latest
+
+		upstreamVersion, err = project_service.LatestVersion(tx, parent.ID)
+		if err != nil {
+			return err
+		}
+		baseData, err := project_service.UpstreamBase(tx, fork)
+		if err != nil {
+			return err
+		}
+
+		// all three sides are upgraded first, so schema changes don't show up as edits
+		var base, ours, theirs models.PipelineData
+		for _, side := range []struct {
+			data datatypes.JSON
+			dst  *models.PipelineData
+		}{{baseData, &base}, {fork.Data, &ours}, {parent.Data, &theirs}} {
+			if *side.dst, err = pipeline_service.DecodePipeline(side.data); err != nil {
+				return err
+			}
+		}
+
+		var merged models.PipelineData
+		merged, conflicts = pipeline_service.Merge(base, ours, theirs)
+		mergedBytes, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+
+		changes := pipeline_service.Diff(ours, merged)
+		if changes.Empty() && upstreamVersion == fork.ParentVersion {
+			return errUpToDate
+		}
+
+		fork.Data = datatypes.JSON(mergedBytes)
+		fork.ParentVersion = upstreamVersion
+		if err := tx.Model(fork).Select("Data", "ParentVersion").Updates(fork).Error; err != nil {
+			return err
+		}
+
+		message := input.Message
+		if message == "" {
+			message = fmt.Sprintf("Pulled version %d from %s", upstreamVersion, parent.Title)
+		}
+		version, err = project_service.RecordVersion(tx, fork, currentUser, message, false)
+		return err
+	})
+	if errors.Is(err, project_service.ErrStaleSave) {
+		fmt.Print("Rejected stale pull into project ", fork.ID)
+		data, ok := migratedData(c, fork.Data)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Project was changed since it was loaded",
+			"project": projectInfo(fork, role),
+			"data":    data,
+			"version": latestVersion,
+		})
+		return
+	}
+	if errors.Is(err, errUpToDate) {
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Project is already up to date",
+			"project":   projectInfo(fork, role),
+			"version":   latestVersion,
+			"conflicts": conflicts,
+		})
+		return
+	}
+	if err != nil {
+		fmt.Print("Failed to pull upstream changes: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pull upstream changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Upstream changes pulled successfully",
+		"project":   projectInfo(fork, role),
+		"data":      fork.Data,
+		"version":   version.Version,
+		"conflicts": conflicts,
+	})
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createFork(t *testing.T, creator models.User, title string, parent *models.Project, published bool) *models.Project {
+	t.Helper()
+	project := &models.Project{
+		CreatorID:       creator.ID,
+		CreatorUsername: creator.Username,
+		Title:           title,
+		Published:       published,
+		Data:            []byte(savedPipeline),
+	}
+	if parent != nil {
+		project.ParentID = &parent.ID
+		project.ParentVersion = 1
+	}
+	if err := initializers.DB.Create(project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	return project
+}
+
+func TestGetProjectForksRedactsInaccessible(t *testing.T) {
+	owner := testUser(t, "fork-owner")
+	private := testUser(t, "fork-private")
+	public := testUser(t, "fork-public")
+
+	root := createFork(t, owner, "Root", nil, false)
+	hidden := createFork(t, private, "Secret fork", root, false)
+	published := createFork(t, public, "Published fork", root, true)
+	createFork(t, owner, "Fork of the secret", hidden, false)
+
+	id := gin.Param{Key: "id", Value: fmt.Sprint(root.ID)}
+	status, res := call(t, GetProjectForks, owner, http.MethodGet, "/api/project/forks", nil, id)
+	if status != http.StatusOK {
+		t.Fatalf("forks: %d %v", status, res)
+	}
+
+	tree := res["tree"].(map[string]interface{})
+	if tree["title"] != "Root" || tree["creatorUsername"] != "fork-owner" {
+		t.Fatalf("root = %v", tree)
+	}
+	forks := tree["forks"].([]interface{})
+	if len(forks) != 2 {
+		t.Fatalf("root has forks %v, want 2", forks)
+	}
+	byID := map[float64]map[string]interface{}{}
+	for _, fork := range forks {
+		node := fork.(map[string]interface{})
+		byID[node["id"].(float64)] = node
+	}
+
+	secret := byID[float64(hidden.ID)]
+	if secret["accessible"] != false {
+		t.Fatalf("private fork is accessible: %v", secret)
+	}
+	if _, ok := secret["title"]; ok {
+		t.Errorf("private fork shows its title: %v", secret)
+	}
+	if _, ok := secret["creatorUsername"]; ok {
+		t.Errorf("private fork shows its creator: %v", secret)
+	}
+	// the tree still goes on past it
+	below := secret["forks"].([]interface{})
+	if len(below) != 1 || below[0].(map[string]interface{})["creatorUsername"] != "fork-owner" {
+		t.Errorf("forks of the private fork = %v", below)
+	}
+
+	shown := byID[float64(published.ID)]
+	if shown["accessible"] != true || shown["title"] != "Published fork" || shown["creatorUsername"] != "fork-public" {
+		t.Errorf("published fork = %v", shown)
+	}
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"edward-lemonade/chive/internal/cv_service"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/utils"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreateJob(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	req, ok := bindPipeRequest(c, currentUser)
+	if !ok {
+		return
+	}
+	// Not tied to the request context, the job has to outlive this request
+	job, err := cv_service.SubmitJob(context.Background(), req.JobRequest(currentUser.ID))
+	req.Close()
+	if err != nil {
+		submitJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job": jobStatusJSON(job.Status()),
+	})
+}
+
+func GetJob(c *gin.Context) {
+	job, ok := findUserJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job": jobStatusJSON(job.Status()),
+	})
+}
+
+func GetJobResult(c *gin.Context) {
+	job, ok := findUserJob(c)
+	if !ok {
+		return
+	}
+
+	status := job.Status()
+	switch status.State {
+	case cv_service.JobSucceeded:
+	case cv_service.JobQueued, cv_service.JobRunning:
+		c.JSON(http.StatusConflict, gin.H{"error": "Job has not finished yet", "job": jobStatusJSON(status)})
+		return
+	default:
+		c.JSON(http.StatusGone, gin.H{"error": "Job did not produce a result", "job": jobStatusJSON(status)})
+		return
+	}
+
+	zipBuffer, err := utils.CreateZip(resultZipEntries(job.Result()))
+	if err != nil {
+		fmt.Print("Failed to create ZIP")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ZIP"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=processed_images.zip")
+	c.Data(http.StatusOK, "application/zip", zipBuffer.Bytes())
+}
+
+// CancelJob stops a queued or running job. Finished jobs are discarded along with their output.
+func CancelJob(c *gin.Context) {
+	job, ok := findUserJob(c)
+	if !ok {
+		return
+	}
+
+	select {
+	case <-job.Done():
+		cv_service.RemoveJob(job.ID)
+	default:
+		job.Cancel()
+		// give cv.exe a moment to die so the response reflects the final state
+		select {
+		case <-job.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job": jobStatusJSON(job.Status()),
+	})
+}
+
+func GetQueueStats(c *gin.Context) {
+	stats := cv_service.Stats()
+
+	utilization := 0.0
+	if stats.Workers > 0 {
+		utilization = float64(stats.BusyWorkers) / float64(stats.Workers)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"depth":             stats.Depth,
+		"capacity":          stats.Capacity,
+		"workers":           stats.Workers,
+		"busyWorkers":       stats.BusyWorkers,
+		"utilization":       utilization,
+		"retryAfterSeconds": retryAfterSeconds(stats.RetryAfter),
+	})
+}
+
+// submitJobError maps a SubmitJob failure to a response, a full queue is a 429 the client can retry
+func submitJobError(c *gin.Context, err error) {
+	if errors.Is(err, cv_service.ErrQueueFull) {
+		retryAfter := retryAfterSeconds(cv_service.Stats().RetryAfter)
+		fmt.Print("Job queue is full")
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Server is busy, try again shortly", "retryAfterSeconds": retryAfter})
+		return
+	}
+
+	fmt.Print("Failed to submit job")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to submit job: %v", err)})
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+// findUserJob loads the job in the :id param, making sure it belongs to the current user
+func findUserJob(c *gin.Context) (*cv_service.Job, bool) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	currentUser := user.(models.User)
+
+	job, ok := cv_service.GetJob(c.Param("id"))
+	if !ok || job.UserID != currentUser.ID {
+		fmt.Print("Job not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return nil, false
+	}
+
+	return job, true
+}
+
+func jobStatusJSON(status cv_service.JobStatus) gin.H {
+	res := gin.H{
+		"id":          status.ID,
+		"state":       status.State,
+		"outputCount": status.OutputCount,
+		"submittedAt": status.SubmittedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if len(status.CapturedNodes) > 0 {
+		res["capturedNodes"] = status.CapturedNodes
+	}
+	if status.State == cv_service.JobQueued {
+		res["queuePosition"] = status.QueuePosition
+	}
+	if !status.StartedAt.IsZero() {
+		res["startedAt"] = status.StartedAt.Format("2006-01-02T15:04:05Z07:00")
+		res["queuedMs"] = status.StartedAt.Sub(status.SubmittedAt).Milliseconds()
+	}
+	if !status.FinishedAt.IsZero() {
+		res["finishedAt"] = status.FinishedAt.Format("2006-01-02T15:04:05Z07:00")
+		if !status.StartedAt.IsZero() {
+			res["runMs"] = status.FinishedAt.Sub(status.StartedAt).Milliseconds()
+		}
+	}
+	if status.Error != nil {
+		res["error"] = status.Error.Error()
+	}
+	return res
+}
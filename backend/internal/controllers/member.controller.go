@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetProjectMembers(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var members []models.ProjectMember
+	if err := initializers.DB.Where("project_id = ?", project.ID).Order("created_at").Find(&members).Error; err != nil {
+		fmt.Print("Failed to fetch members: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+
+	userIDs := make([]uint, len(members))
+	for i, member := range members {
+		userIDs[i] = member.UserID
+	}
+	usernames := map[uint]string{}
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := initializers.DB.Select("ID", "Username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			fmt.Print("Failed to fetch members: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+			return
+		}
+		for _, user := range users {
+			usernames[user.ID] = user.Username
+		}
+	}
+
+	// the creator is always listed first, as an owner
+	memberInfos := []models.ProjectMemberInfo{{
+		UserID:   project.CreatorID,
+		Username: project.CreatorUsername,
+		Role:     models.RoleOwner,
+		Creator:  true,
+	}}
+	for _, member := range members {
+		memberInfos = append(memberInfos, models.ProjectMemberInfo{
+			UserID:   member.UserID,
+			Username: usernames[member.UserID],
+			Role:     member.Role,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": memberInfos,
+	})
+}
+
+// AddProjectMember gives another user access to a project by username
+func AddProjectMember(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var input models.ProjectMemberInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if !input.Role.Valid() {
+		fmt.Print("Invalid role")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, editor or viewer"})
+		return
+	}
+
+	var invitee models.User
+	if err := initializers.DB.Where("username = ?", input.Username).First(&invitee).Error; err != nil {
+		fmt.Print("User not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if invitee.ID == project.CreatorID {
+		fmt.Print("User already owns project")
+		c.JSON(http.StatusConflict, gin.H{"error": "User is the project's creator"})
+		return
+	}
+
+	var existing int64
+	initializers.DB.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", project.ID, invitee.ID).Count(&existing)
+	if existing > 0 {
+		fmt.Print("User is already a member")
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this project"})
+		return
+	}
+
+	member := models.ProjectMember{
+		ProjectID: project.ID,
+		UserID:    invitee.ID,
+		Role:      input.Role,
+	}
+	if err := initializers.DB.Create(&member).Error; err != nil {
+		fmt.Print("Failed to add member: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member added successfully",
+		"member": models.ProjectMemberInfo{
+			UserID:   invitee.ID,
+			Username: invitee.Username,
+			Role:     member.Role,
+		},
+	})
+}
+
+func UpdateProjectMember(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var input models.ProjectMemberRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if !input.Role.Valid() {
+		fmt.Print("Invalid role")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, editor or viewer"})
+		return
+	}
+
+	member, ok := findProjectMember(c, project)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Model(member).Update("role", input.Role).Error; err != nil {
+		fmt.Print("Failed to update member: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member updated successfully",
+	})
+}
+
+// RemoveProjectMember revokes a member's access. Owners can remove anyone, and any
+// member can remove themselves to leave a project.
+func RemoveProjectMember(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	required := models.RoleOwner
+	if c.Param("userId") == fmt.Sprint(currentUser.ID) {
+		required = models.RoleViewer
+	}
+	project, _, ok := findProject(c, required)
+	if !ok {
+		return
+	}
+
+	member, ok := findProjectMember(c, project)
+	if !ok {
+		return
+	}
+
+	// the project leaves the member's folders along with their access
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(member).Error; err != nil {
+			return err
+		}
+		return project_service.MoveToFolder(tx, member.UserID, project.ID, nil)
+	})
+	if err != nil {
+		fmt.Print("Failed to remove member: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed successfully",
+	})
+}
+
+// findProjectMember loads the membership in the :userId param of an already authorized
+// project. The creator has no membership, so their access can't be changed.
+func findProjectMember(c *gin.Context, project *models.Project) (*models.ProjectMember, bool) {
+	var userID uint
+	if _, err := fmt.Sscanf(c.Param("userId"), "%d", &userID); err != nil {
+		fmt.Print("Invalid user ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+	if userID == project.CreatorID {
+		fmt.Print("Cannot change the creator's access")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The project's creator always stays an owner"})
+		return nil, false
+	}
+
+	var member models.ProjectMember
+	result := initializers.DB.Where("project_id = ? AND user_id = ?", project.ID, userID).First(&member)
+	if result.Error != nil {
+		fmt.Print("Member not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return nil, false
+	}
+
+	return &member, true
+}
@@ -4,18 +4,52 @@ import (
 	"edward-lemonade/chive/internal/cv_service"
 	"edward-lemonade/chive/internal/initializers"
 	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/pipeline_service"
 	"edward-lemonade/chive/internal/utils"
-	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Pipe(c *gin.Context) {
+// GetNodes lists every node type the server can run, for the editor's palette
+func GetNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":         pipeline_service.Nodes(),
+		"schemaVersion": pipeline_service.CurrentSchemaVersion,
+	})
+}
+
+func ValidatePipeline(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		fmt.Print("Failed to read request body: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	// validate what the pipeline becomes once upgraded, like execution does
+	pipelineData, err := pipeline_service.DecodePipeline(body)
+	if err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+
+	diagnostics := pipeline_service.Validate(pipelineData)
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       !pipeline_service.HasErrors(diagnostics),
+		"diagnostics": diagnostics,
+	})
+}
+
+// DiffPipelines compares two pipelines, each either sent inline or loaded from a project
+func DiffPipelines(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
 		fmt.Print("User not authenticated")
@@ -25,25 +59,115 @@ func Pipe(c *gin.Context) {
 
 	currentUser := user.(models.User)
 
+	var input models.PipelineDiffInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+
+	base, ok := loadPipelineSource(c, currentUser, input.Base, "base")
+	if !ok {
+		return
+	}
+	target, ok := loadPipelineSource(c, currentUser, input.Target, "target")
+	if !ok {
+		return
+	}
+
+	diff := pipeline_service.Diff(*base, *target)
+	c.JSON(http.StatusOK, gin.H{
+		"identical": diff.Empty(),
+		"diff":      diff,
+	})
+}
+
+// loadPipelineSource resolves one side of a diff. On failure it writes the error
+// response itself and returns false.
+func loadPipelineSource(c *gin.Context, currentUser models.User, source models.PipelineSource, side string) (*models.PipelineData, bool) {
+	if source.Data != nil {
+		return source.Data, true
+	}
+	if source.ProjectID == 0 {
+		fmt.Print("No pipeline given for ", side)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Either data or projectId is required for %s", side)})
+		return nil, false
+	}
+
+	project, _, ok := authorizeProject(c, initializers.DB, source.ProjectID, currentUser, models.RoleViewer)
+	if !ok {
+		return nil, false
+	}
+
+	data := project.Data
+	if source.Version != 0 {
+		var version models.ProjectVersion
+		result := initializers.DB.Where("project_id = ? AND version = ?", project.ID, source.Version).First(&version)
+		if result.Error != nil {
+			fmt.Print("Version not found")
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Version for %s not found", side)})
+			return nil, false
+		}
+		data = version.Data
+	}
+
+	pipelineData, err := pipeline_service.DecodePipeline(data)
+	if err != nil {
+		fmt.Print("Failed to parse stored pipeline: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Stored pipeline for %s is invalid", side)})
+		return nil, false
+	}
+	return &pipelineData, true
+}
+
+// uploads with more images than this are always scheduled as batch jobs
+const maxPreviewImages = 4
+
+// pipeRequest is the parsed multipart body shared by /api/pipe and /api/jobs
+type pipeRequest struct {
+	fileReaders []io.Reader
+	filenames   []string
+	pipeline    models.PipelineData
+	priority    cv_service.Priority
+	capture     cv_service.Capture
+	openFiles   []multipart.File
+}
+
+func (req *pipeRequest) JobRequest(userID uint) cv_service.JobRequest {
+	return cv_service.JobRequest{
+		UserID:        userID,
+		Priority:      req.priority,
+		UploadedFiles: req.fileReaders,
+		Filenames:     req.filenames,
+		Pipeline:      req.pipeline,
+		Capture:       req.capture,
+	}
+}
+
+func (req *pipeRequest) Close() {
+	for _, file := range req.openFiles {
+		file.Close()
+	}
+}
+
+// bindPipeRequest checks project access and parses the uploaded images and pipeline.
+// On failure it writes the error response itself and returns false.
+func bindPipeRequest(c *gin.Context, currentUser models.User) (*pipeRequest, bool) {
 	// Verify project access
 	projectID := c.Query("id")
 	if projectID == "" {
 		fmt.Print("Project ID is required")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Project ID is required"})
-		return
+		return nil, false
 	}
 	var projectIDUint uint
 	if _, err := fmt.Sscanf(projectID, "%d", &projectIDUint); err != nil {
 		fmt.Print("Invalid project ID")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
-		return
+		return nil, false
 	}
-	var project models.Project
-	projectResult := initializers.DB.Where("ID = ? AND creator_id = ?", projectIDUint, currentUser.ID).First(&project)
-	if projectResult.Error != nil {
-		fmt.Print("Project not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
-		return
+	if _, _, ok := authorizeProject(c, initializers.DB, projectIDUint, currentUser, models.RoleViewer); !ok {
+		return nil, false
 	}
 
 	// Form
@@ -51,7 +175,7 @@ func Pipe(c *gin.Context) {
 	if err != nil {
 		fmt.Print("Failed to parse form data")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
-		return
+		return nil, false
 	}
 
 	// Retrieve images
@@ -59,7 +183,7 @@ func Pipe(c *gin.Context) {
 	if len(files) == 0 {
 		fmt.Print("No images uploaded")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No images uploaded"})
-		return
+		return nil, false
 	}
 
 	// Retrieve pipeline data
@@ -67,57 +191,100 @@ func Pipe(c *gin.Context) {
 	if len(dataValues) == 0 {
 		fmt.Print("Pipeline data not provided")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Pipeline data not provided"})
-		return
+		return nil, false
 	}
-	var pipelineData models.PipelineData
-	if err := json.Unmarshal([]byte(dataValues[0]), &pipelineData); err != nil {
+	// pipelines from older editors are upgraded before the executor sees them
+	pipelineData, err := pipeline_service.DecodePipeline([]byte(dataValues[0]))
+	if err != nil {
 		fmt.Print("Failed to parse pipeline data JSON: ", err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pipeline data JSON", "details": err.Error()})
-		return
+		return nil, false
+	}
+	diagnostics := pipeline_service.Validate(pipelineData)
+	if pipeline_service.HasErrors(diagnostics) {
+		fmt.Print("Pipeline failed validation")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pipeline", "diagnostics": diagnostics})
+		return nil, false
 	}
 
-	// Prepare file readers and names
-	var fileReaders []io.Reader
-	var filenames []string
-	var openFiles []*multipart.File
+	// Small uploads are previews and jump ahead of exports, unless the client asks for batch
+	priority := cv_service.PriorityInteractive
+	if len(files) > maxPreviewImages || c.Query("priority") == "batch" || c.PostForm("priority") == "batch" {
+		priority = cv_service.PriorityBatch
+	}
+
+	// Intermediate images to keep, "all" or a comma separated list of node IDs
+	captureValue := c.Query("capture")
+	if captureValue == "" {
+		captureValue = c.PostForm("capture")
+	}
+	var capture cv_service.Capture
+	if captureValue == "all" {
+		capture.All = true
+	} else if captureValue != "" {
+		for _, nodeID := range strings.Split(captureValue, ",") {
+			nodeID = strings.TrimSpace(nodeID)
+			if pipelineData.NodeByID(nodeID) == nil {
+				fmt.Print("Unknown node in capture: ", nodeID)
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown node in capture: %s", nodeID)})
+				return nil, false
+			}
+			capture.NodeIDs = append(capture.NodeIDs, nodeID)
+		}
+	}
 
+	// Prepare file readers and names
+	req := &pipeRequest{pipeline: pipelineData, priority: priority, capture: capture}
 	for _, fileHeader := range files {
 		file, err := fileHeader.Open()
 		if err != nil {
 			continue
 		}
 
-		openFiles = append(openFiles, &file)
-		fileReaders = append(fileReaders, file)
-		filenames = append(filenames, fileHeader.Filename)
+		req.openFiles = append(req.openFiles, file)
+		req.fileReaders = append(req.fileReaders, file)
+		req.filenames = append(req.filenames, fileHeader.Filename)
 	}
 
-	// Close all files when done
-	defer func() {
-		for _, file := range openFiles {
-			(*file).Close()
-		}
-	}()
+	return req, true
+}
+
+func Pipe(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
 
-	job, err := cv_service.SubmitJob(fileReaders, filenames, pipelineData)
+	req, ok := bindPipeRequest(c, currentUser)
+	if !ok {
+		return
+	}
+	// Inputs are staged to disk by SubmitJob, so the uploads can be closed right after.
+	// The job is tied to the request, so a client disconnect kills it too.
+	job, err := cv_service.SubmitJob(c.Request.Context(), req.JobRequest(currentUser.ID))
+	req.Close()
 	if err != nil {
-		fmt.Print("Failed to submit job")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to submit job: %v", err)})
+		submitJobError(c, err)
 		return
 	}
 
 	// Wait for result with timeout
 	select {
-	case result := <-job.ResultChan:
-		defer cv_service.CleanupJobFiles(result.JobID)
+	case <-job.Done():
+		defer cv_service.RemoveJob(job.ID)
 
+		result := job.Result()
 		if result.Error != nil {
 			fmt.Printf("Processing failed: %v", result.Error)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Processing failed: %v", result.Error)})
 			return
 		}
 
-		zipBuffer, err := utils.CreateZipFromFiles(result.OutputFiles)
+		zipBuffer, err := utils.CreateZip(resultZipEntries(result))
 		if err != nil {
 			fmt.Print("Failed to create ZIP")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ZIP"})
@@ -129,9 +296,31 @@ func Pipe(c *gin.Context) {
 		c.Data(http.StatusOK, "application/zip", zipBuffer.Bytes())
 
 	case <-time.After(5 * time.Minute): // 5 minute timeout
+		job.Cancel()
 		fmt.Print("Processing timeout")
 		c.JSON(http.StatusRequestTimeout, gin.H{"error": "Processing timeout"})
 		return
 	}
 
 }
+
+// resultZipEntries lays out a job's zip: final images at the top level, and the images
+// of each captured node under nodes/<nodeId>/
+func resultZipEntries(result *cv_service.ProcessingResult) []utils.ZipEntry {
+	var entries []utils.ZipEntry
+	for _, path := range result.OutputFiles {
+		entries = append(entries, utils.ZipEntry{Name: filepath.Base(path), Path: path})
+	}
+
+	nodeIDs := make([]string, 0, len(result.NodeOutputs))
+	for nodeID := range result.NodeOutputs {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	for _, nodeID := range nodeIDs {
+		for _, path := range result.NodeOutputs[nodeID] {
+			entries = append(entries, utils.ZipEntry{Name: "nodes/" + nodeID + "/" + filepath.Base(path), Path: path})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/cv_service"
+	"edward-lemonade/chive/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResultZipEntries(t *testing.T) {
+	outputDir := t.TempDir()
+	write := func(name string) string {
+		t.Helper()
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	result := &cv_service.ProcessingResult{
+		OutputFiles: []string{write("a.png"), write("b.png")},
+		NodeOutputs: map[string][]string{
+			"output": {write("nodes/output/a.png"), write("nodes/output/b.png")},
+			"blur-1": {write("nodes/blur-1/a.png"), write("nodes/blur-1/b.png")},
+		},
+	}
+	buf, err := utils.CreateZip(resultZipEntries(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := utils.ReadZip(buf.Bytes(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"a.png",
+		"b.png",
+		"nodes/blur-1/a.png",
+		"nodes/blur-1/b.png",
+		"nodes/output/a.png",
+		"nodes/output/b.png",
+	}
+	if len(files) != len(want) {
+		t.Fatalf("zip holds %d files, want %v", len(files), want)
+	}
+	for _, name := range want {
+		if string(files[name]) != name {
+			t.Fatalf("zip entry %s = %q", name, files[name])
+		}
+	}
+
+	// node images come after the final ones, grouped by node in ID order
+	var names []string
+	for _, entry := range resultZipEntries(result) {
+		names = append(names, entry.Name)
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("zip entries = %v, want %v", names, want)
+	}
+}
+
+func TestResultZipEntriesWithoutCapture(t *testing.T) {
+	result := &cv_service.ProcessingResult{OutputFiles: []string{"/work/output/job/a.png"}}
+	entries := resultZipEntries(result)
+	if len(entries) != 1 || entries[0].Name != "a.png" || entries[0].Path != "/work/output/job/a.png" {
+		t.Fatalf("zip entries = %+v", entries)
+	}
+}
@@ -3,12 +3,19 @@ package controllers
 import (
 	"edward-lemonade/chive/internal/initializers"
 	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/pipeline_service"
+	"edward-lemonade/chive/internal/project_service"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 func SaveProject(c *gin.Context) {
@@ -28,6 +35,17 @@ func SaveProject(c *gin.Context) {
 		return
 	}
 
+	// The editor only ever has pipelines upgraded by LoadProject, so saves are current
+	if projectInput.Data.SchemaVersion > pipeline_service.CurrentSchemaVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pipeline schema version is newer than this server supports"})
+		fmt.Print("Pipeline schema version too new")
+		return
+	}
+	projectInput.Data.SchemaVersion = pipeline_service.CurrentSchemaVersion
+
+	// Work-in-progress graphs are still saved, the editor just gets told what is wrong
+	diagnostics := pipeline_service.Validate(projectInput.Data)
+
 	dataBytes, err := json.Marshal(projectInput.Data)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal project data"})
@@ -39,12 +57,73 @@ func SaveProject(c *gin.Context) {
 
 	// If ID is non-zero, try to find and update existing project
 	if projectInput.ID != 0 {
-		result := initializers.DB.Where("ID = ? AND creator_id = ?", projectInput.ID, currentUser.ID).First(&project)
-		if result.Error == nil {
-			// Update existing project
-			project.Title = projectInput.Title
-			project.Data = datatypes.JSON(dataBytes)
-			if err := initializers.DB.Save(&project).Error; err != nil {
+		existing, _, err := project_service.Authorize(initializers.DB, projectInput.ID, currentUser.ID, models.RoleEditor)
+		if err != nil && !errors.Is(err, project_service.ErrProjectNotFound) {
+			projectAccessError(c, err)
+			return
+		}
+		if err != nil {
+			// saving a trashed project must not quietly fork a copy of it
+			trashed, _, trashErr := project_service.Authorize(initializers.DB.Unscoped(), projectInput.ID, currentUser.ID, models.RoleEditor)
+			if trashErr == nil && trashed.DeletedAt.Valid {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "Project is in the trash, restore it before saving",
+					"purgeAt": project_service.PurgeAt(trashed.DeletedAt.Time).Format("2006-01-02T15:04:05Z07:00"),
+				})
+				fmt.Print("Rejected save of trashed project ", trashed.ID)
+				return
+			}
+		}
+		if err == nil {
+			project = *existing
+
+			// Update existing project, unless someone else saved it since the editor loaded it
+			var version *models.ProjectVersion
+			var latestVersion int
+			err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+				current, latest, err := project_service.LockForSave(tx, project.ID, projectInput.BaseVersion, projectInput.BaseUpdatedAt)
+				if err != nil {
+					if current != nil {
+						project, latestVersion = *current, latest
+					}
+					return err
+				}
+
+				project = *current
+				recordVersion := project_service.RecordVersion
+				if project.Title != projectInput.Title {
+					recordVersion = project_service.RecordRename
+				}
+				project.Title = projectInput.Title
+				project.Data = datatypes.JSON(dataBytes)
+				if err := tx.Save(&project).Error; err != nil {
+					return err
+				}
+				version, err = recordVersion(tx, &project, currentUser, projectInput.Message, projectInput.Autosave)
+				return err
+			})
+			if errors.Is(err, project_service.ErrStaleSave) {
+				fmt.Print("Rejected stale save of project ", project.ID)
+				data, ok := migratedData(c, project.Data)
+				if !ok {
+					return
+				}
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "Project was changed since it was loaded",
+					// the server copy, so the editor can merge or overwrite
+					"project": gin.H{
+						"id":          project.ID,
+						"title":       project.Title,
+						"description": project.Description,
+						"data":        data,
+						"createdAt":   project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+						"updatedAt":   project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+					},
+					"version": latestVersion,
+				})
+				return
+			}
+			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 				fmt.Print("Failed to update project: ", err.Error())
 				return
@@ -57,12 +136,14 @@ func SaveProject(c *gin.Context) {
 					"createdAt": project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 					"updatedAt": project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 				},
+				"version":     version.Version,
+				"diagnostics": diagnostics,
 			})
 			return
 		}
 	}
 
-	// Create new project (ID not provided or project not found)
+	// Create new project (ID not provided, or no such project)
 	project = models.Project{
 		CreatorID:       currentUser.ID,
 		CreatorUsername: currentUser.Username,
@@ -70,7 +151,16 @@ func SaveProject(c *gin.Context) {
 		Data:            datatypes.JSON(dataBytes),
 	}
 
-	if err := initializers.DB.Create(&project).Error; err != nil {
+	var version *models.ProjectVersion
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		var err error
+		version, err = project_service.RecordVersion(tx, &project, currentUser, projectInput.Message, projectInput.Autosave)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save project"})
 		fmt.Print("Failed to save project")
 		return
@@ -84,6 +174,8 @@ func SaveProject(c *gin.Context) {
 			"createdAt": project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 			"updatedAt": project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		},
+		"version":     version.Version,
+		"diagnostics": diagnostics,
 	})
 }
 
@@ -111,22 +203,38 @@ func LoadProject(c *gin.Context) {
 		return
 	}
 
-	var project models.Project
-	result := initializers.DB.Where("ID = ? AND creator_id = ?", projectIDUint, currentUser.ID).First(&project)
+	project, role, ok := authorizeProject(c, initializers.DB, projectIDUint, currentUser, models.RoleViewer)
+	if !ok {
+		return
+	}
 
-	if result.Error != nil {
-		fmt.Print("Project not found")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	// Sent back as baseVersion on the next save
+	version, err := project_service.LatestVersion(initializers.DB, project.ID)
+	if err != nil {
+		fmt.Print("Failed to look up project version: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
+		return
+	}
+
+	// Older pipelines are upgraded on the way out, and stored upgraded on the next save
+	data, migratedFrom, err := pipeline_service.MigratePipeline(project.Data)
+	if err != nil {
+		fmt.Print("Failed to migrate stored pipeline: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Stored pipeline is invalid"})
 		return
 	}
 
 	// ChiveProject format
 	c.JSON(http.StatusOK, gin.H{
-		"id":        project.ID,
-		"title":     project.Title,
-		"data":      project.Data,
-		"createdAt": project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		"updatedAt": project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		"id":          project.ID,
+		"title":       project.Title,
+		"description": project.Description,
+		"data":        datatypes.JSON(data),
+		"createdAt":   project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		"updatedAt":   project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		"version":     version,
+		"migrated":    migratedFrom < pipeline_service.CurrentSchemaVersion,
+		"role":        role,
 	})
 }
 
@@ -151,29 +259,36 @@ func GetProjectInfo(c *gin.Context) {
 		return
 	}
 
-	var project models.Project
-	result := initializers.DB.Select("ID", "CreatorID", "CreatorUsername", "Title", "CreatedAt", "UpdatedAt").
-		Where("ID = ? AND creator_id = ?", projectIDUint, currentUser.ID).
-		First(&project)
-
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	project, role, ok := authorizeProject(c, initializers.DB, projectIDUint, currentUser, models.RoleViewer)
+	if !ok {
+		return
+	}
+	if err := initializers.DB.Model(project).Association("Tags").Find(&project.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
+		return
+	}
+	folders, err := project_service.FoldersFor(initializers.DB, []models.Project{*project}, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load project"})
 		return
 	}
 
-	projectInfo := models.ProjectInfo{
-		ID:              project.ID,
-		CreatorID:       project.CreatorID,
-		CreatorUsername: project.CreatorUsername,
-		Title:           project.Title,
-		CreatedAt:       project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt:       project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	info := projectInfo(project, role)
+	if folderID, ok := folders[project.ID]; ok {
+		info.FolderID = &folderID
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"project": projectInfo,
+		"project": info,
 	})
 }
+
+// GetProjectInfos pages through the user's projects. Query params: q searches titles,
+// folder is a folder ID or none for projects in no folder, tags (comma separated)
+// filters to projects with all of them, createdAfter,
+// createdBefore, updatedAfter and updatedBefore filter by date, sort is updated
+// (default), created or title, order is asc or desc, plus limit and the cursor of the
+// previous page.
 func GetProjectInfos(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
@@ -183,30 +298,443 @@ func GetProjectInfos(c *gin.Context) {
 
 	currentUser := user.(models.User)
 
+	query, ok := bindProjectListQuery(c, currentUser)
+	if !ok {
+		return
+	}
+
+	projects, nextCursor, err := project_service.ListProjects(initializers.DB, currentUser.ID, query)
+	if errors.Is(err, project_service.ErrInvalidCursor) {
+		fmt.Print("Invalid cursor")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		fmt.Print("Failed to fetch projects: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		return
+	}
+
+	roles, err := project_service.RolesFor(initializers.DB, projects, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		return
+	}
+	folders, err := project_service.FoldersFor(initializers.DB, projects, currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		return
+	}
+
+	projectInfos := make([]models.ProjectInfo, len(projects))
+	for i := range projects {
+		projectInfos[i] = projectInfo(&projects[i], roles[projects[i].ID])
+		if folderID, ok := folders[projects[i].ID]; ok {
+			projectInfos[i].FolderID = &folderID
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"projects":   projectInfos,
+		"nextCursor": nextCursor,
+	})
+}
+
+// bindProjectListQuery parses GetProjectInfos' query params
+func bindProjectListQuery(c *gin.Context, currentUser models.User) (project_service.ProjectListQuery, bool) {
+	query := project_service.ProjectListQuery{
+		Search: c.Query("q"),
+		Sort:   project_service.ProjectSort(c.DefaultQuery("sort", string(project_service.SortUpdated))),
+		Cursor: c.Query("cursor"),
+	}
+	if !query.Sort.Valid() {
+		fmt.Print("Invalid sort")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be updated, created or title"})
+		return query, false
+	}
+
+	// titles read A to Z, dates newest first
+	switch c.Query("order") {
+	case "":
+		query.Ascending = query.Sort == project_service.SortTitle
+	case "asc":
+		query.Ascending = true
+	case "desc":
+		query.Ascending = false
+	default:
+		fmt.Print("Invalid order")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return query, false
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 || query.Limit > project_service.MaxProjectPageSize {
+			fmt.Print("Invalid limit")
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", project_service.MaxProjectPageSize)})
+			return query, false
+		}
+	}
+
+	switch folder := c.Query("folder"); folder {
+	case "":
+	case "none":
+		query.Folder = new(uint)
+	default:
+		var folderID uint
+		if _, err := fmt.Sscanf(folder, "%d", &folderID); err != nil {
+			fmt.Print("Invalid folder ID")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+			return query, false
+		}
+		if _, err := project_service.FindFolder(initializers.DB, currentUser.ID, folderID); err != nil {
+			folderError(c, err)
+			return query, false
+		}
+		query.Folder = &folderID
+	}
+
+	if tags := c.Query("tags"); tags != "" {
+		var err error
+		if query.Tags, err = project_service.NormalizeTags(strings.Split(tags, ",")); err != nil {
+			fmt.Print("Invalid tags: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return query, false
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"createdAfter":  &query.CreatedAfter,
+		"createdBefore": &query.CreatedBefore,
+		"updatedAfter":  &query.UpdatedAfter,
+		"updatedBefore": &query.UpdatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value)
+		if err != nil {
+			fmt.Print("Invalid ", param)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be a date (2006-01-02) or timestamp (2006-01-02T15:04:05Z07:00)", param)})
+			return query, false
+		}
+		*dst = &t
+	}
+
+	return query, true
+}
+
+// parseDateParam accepts a full timestamp or a bare date, read as midnight UTC
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02T15:04:05Z07:00", value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// DeleteProject moves a project to the trash, it can be restored until it is purged
+func DeleteProject(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(project).Error; err != nil {
+		fmt.Print("Failed to delete project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project moved to trash",
+		"purgeAt": project_service.PurgeAt(time.Now()).Format("2006-01-02T15:04:05Z07:00"),
+	})
+}
+
+func GetTrashedProjects(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
 	var projects []models.Project
-	result := initializers.DB.Select("ID", "CreatorID", "CreatorUsername", "Title", "CreatedAt", "UpdatedAt").
-		Where("creator_id = ?", currentUser.ID).
-		Order("updated_at DESC").
+	result := initializers.DB.Unscoped().
+		Select("ID", "CreatorID", "CreatorUsername", "Title", "Description", "Published", "TemplateID", "ParentID", "ParentVersion", "CreatedAt", "UpdatedAt", "DeletedAt").
+		Preload("Tags").
+		Scopes(project_service.OwnedBy(currentUser.ID)).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
 		Find(&projects)
 
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
 		return
 	}
 
-	projectInfos := make([]models.ProjectInfo, len(projects))
-	for i, project := range projects {
-		projectInfos[i] = models.ProjectInfo{
-			ID:              project.ID,
-			CreatorID:       project.CreatorID,
-			CreatorUsername: project.CreatorUsername,
-			Title:           project.Title,
-			CreatedAt:       project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt:       project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	projectInfos := make([]models.TrashedProjectInfo, len(projects))
+	for i := range projects {
+		deletedAt := projects[i].DeletedAt.Time
+		projectInfos[i] = models.TrashedProjectInfo{
+			ProjectInfo: projectInfo(&projects[i], models.RoleOwner),
+			DeletedAt:   deletedAt.Format("2006-01-02T15:04:05Z07:00"),
+			PurgeAt:     project_service.PurgeAt(deletedAt).Format("2006-01-02T15:04:05Z07:00"),
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"projects": projectInfos,
+		"projects":       projectInfos,
+		"retentionHours": int(project_service.TrashRetention().Hours()),
 	})
 }
+
+// RestoreProject takes a project back out of the trash
+func RestoreProject(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	var projectIDUint uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &projectIDUint); err != nil {
+		fmt.Print("Invalid project ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	project, role, ok := authorizeProject(c, initializers.DB.Unscoped(), projectIDUint, currentUser, models.RoleOwner)
+	if !ok {
+		return
+	}
+	if !project.DeletedAt.Valid {
+		fmt.Print("Project not found in trash")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found in trash"})
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Model(project).Update("deleted_at", nil).Error; err != nil {
+		fmt.Print("Failed to restore project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project restored successfully",
+		"project": projectInfo(project, role),
+	})
+}
+
+// UpdateProject renames a project or changes its description or tags, leaving the pipeline alone
+func UpdateProject(c *gin.Context) {
+	project, role, ok := findProject(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var patch models.ProjectPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		fmt.Print("Error binding JSON: ", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if patch.Title != nil {
+		title := strings.TrimSpace(*patch.Title)
+		if title == "" {
+			fmt.Print("Title cannot be empty")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title cannot be empty"})
+			return
+		}
+		updates["title"] = title
+	}
+	if patch.Description != nil {
+		updates["description"] = *patch.Description
+	}
+	var tags []string
+	if patch.Tags != nil {
+		var err error
+		if tags, err = project_service.NormalizeTags(*patch.Tags); err != nil {
+			fmt.Print("Invalid tags: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(updates) == 0 && patch.Tags == nil {
+		fmt.Print("Nothing to update")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(project).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if patch.Tags != nil {
+			return project_service.SetProjectTags(tx, project, tags)
+		}
+		return tx.Model(project).Association("Tags").Find(&project.Tags)
+	})
+	if err != nil {
+		fmt.Print("Failed to update project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project updated successfully",
+		"project": projectInfo(project, role),
+	})
+}
+
+// DuplicateProject copies a project, pipeline included, under a new title
+func DuplicateProject(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	original, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+	if err := initializers.DB.Model(original).Association("Tags").Find(&original.Tags); err != nil {
+		fmt.Print("Failed to load tags: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate project"})
+		return
+	}
+
+	// The body is optional, without a title the copy is named after the original
+	var input models.ProjectDuplicateInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			fmt.Print("Error binding JSON: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+			return
+		}
+	}
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = original.Title + " (copy)"
+	}
+
+	project := models.Project{
+		CreatorID:       currentUser.ID,
+		CreatorUsername: currentUser.Username,
+		Title:           title,
+		Description:     original.Description,
+		Data:            append(datatypes.JSON(nil), original.Data...),
+		Tags:            original.Tags,
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := project_service.SetParent(tx, &project, original); err != nil {
+			return err
+		}
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		_, err := project_service.RecordVersion(tx, &project, currentUser, fmt.Sprintf("Duplicated from %s", original.Title), false)
+		return err
+	})
+	if err != nil {
+		fmt.Print("Failed to duplicate project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project duplicated successfully",
+		"project": projectInfo(&project, models.RoleOwner),
+	})
+}
+
+// migratedData upgrades a stored pipeline to the current schema before it is sent out
+func migratedData(c *gin.Context, data datatypes.JSON) (datatypes.JSON, bool) {
+	migrated, _, err := pipeline_service.MigratePipeline(data)
+	if err != nil {
+		fmt.Print("Failed to migrate stored pipeline: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Stored pipeline is invalid"})
+		return nil, false
+	}
+	return datatypes.JSON(migrated), true
+}
+
+// findProject loads the project in the :id param, making sure the current user holds at
+// least the required role on it
+func findProject(c *gin.Context, required models.ProjectRole) (*models.Project, models.ProjectRole, bool) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, "", false
+	}
+
+	currentUser := user.(models.User)
+
+	var projectIDUint uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &projectIDUint); err != nil {
+		fmt.Print("Invalid project ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return nil, "", false
+	}
+
+	return authorizeProject(c, initializers.DB, projectIDUint, currentUser, required)
+}
+
+// authorizeProject runs the shared permission check. On failure it writes the error
+// response itself and returns false.
+func authorizeProject(c *gin.Context, db *gorm.DB, projectID uint, currentUser models.User, required models.ProjectRole) (*models.Project, models.ProjectRole, bool) {
+	project, role, err := project_service.Authorize(db, projectID, currentUser.ID, required)
+	if err != nil {
+		projectAccessError(c, err)
+		return nil, "", false
+	}
+	return project, role, true
+}
+
+func projectAccessError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, project_service.ErrProjectNotFound):
+		fmt.Print("Project not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+	case errors.Is(err, project_service.ErrForbidden):
+		fmt.Print("Insufficient project role")
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do that on this project"})
+	default:
+		fmt.Print("Failed to check project access: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+	}
+}
+
+func projectInfo(project *models.Project, role models.ProjectRole) models.ProjectInfo {
+	return models.ProjectInfo{
+		ID:              project.ID,
+		CreatorID:       project.CreatorID,
+		CreatorUsername: project.CreatorUsername,
+		Title:           project.Title,
+		Description:     project.Description,
+		Tags:            project_service.TagNames(project.Tags),
+		Published:       project.Published,
+		TemplateID:      project.TemplateID,
+		ParentID:        project.ParentID,
+		ParentVersion:   project.ParentVersion,
+		Role:            role,
+		CreatedAt:       project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:       project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"bytes"
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain runs the handlers against an in-memory database
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	// every connection to :memory: is its own database
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Tag{},
+		&models.Project{},
+		&models.ProjectVersion{},
+		&models.ProjectMember{},
+		&models.ShareLink{},
+	)
+	if err != nil {
+		log.Fatal("Failed to migrate test database: ", err)
+	}
+	initializers.DB = db
+
+	os.Exit(m.Run())
+}
+
+func testUser(t *testing.T, username string) models.User {
+	t.Helper()
+	user := models.User{Username: username}
+	if err := initializers.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// call runs a handler as user, with body sent as JSON and params standing in for the
+// route's path params
+func call(t *testing.T, handler gin.HandlerFunc, user models.User, method string, target string, body interface{}, params ...gin.Param) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(method, target, bytes.NewReader(data))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("currentUser", user)
+	handler(c)
+
+	var res map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		t.Fatalf("response %q is not JSON: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code, res
+}
+
+func saveProject(t *testing.T, user models.User, body gin.H) (int, map[string]interface{}) {
+	t.Helper()
+	return call(t, SaveProject, user, http.MethodPost, "/api/project/save", body)
+}
+
+const savedPipeline = `{"nodes":[{"id":"s","data":{"name":"Source","cvNodeType":"source"}}],"edges":[]}`
+
+func pipelineWith(name string) json.RawMessage {
+	return json.RawMessage(`{"nodes":[{"id":"s","data":{"name":"` + name + `","cvNodeType":"source"}}],"edges":[]}`)
+}
+
+func TestSaveProjectRejectsStaleBase(t *testing.T) {
+	user := testUser(t, "stale-save")
+
+	status, res := saveProject(t, user, gin.H{"title": "Project", "data": json.RawMessage(savedPipeline)})
+	if status != http.StatusOK {
+		t.Fatalf("create: %d %v", status, res)
+	}
+	id := res["project"].(map[string]interface{})["id"]
+	if res["version"] != 1.0 {
+		t.Fatalf("first save is version %v, want 1", res["version"])
+	}
+
+	// two editors load version 1, the first one to save wins
+	status, res = saveProject(t, user, gin.H{"id": id, "title": "Project", "data": pipelineWith("first"), "baseVersion": 1})
+	if status != http.StatusOK || res["version"] != 2.0 {
+		t.Fatalf("first save: %d %v, want version 2", status, res)
+	}
+	status, res = saveProject(t, user, gin.H{"id": id, "title": "Project", "data": pipelineWith("second"), "baseVersion": 1})
+	if status != http.StatusConflict {
+		t.Fatalf("stale save: %d %v, want 409", status, res)
+	}
+	if res["version"] != 2.0 {
+		t.Fatalf("conflict reports version %v, want 2", res["version"])
+	}
+
+	var project models.Project
+	if err := initializers.DB.First(&project, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(project.Data, []byte(`"first"`)) {
+		t.Fatalf("stale save overwrote the project: %s", project.Data)
+	}
+}
+
+func TestSaveProjectRenameMakesOthersStale(t *testing.T) {
+	user := testUser(t, "stale-rename")
+
+	_, res := saveProject(t, user, gin.H{"title": "Project", "data": json.RawMessage(savedPipeline)})
+	id := res["project"].(map[string]interface{})["id"]
+
+	// a save that only renames still moves the version on
+	status, res := saveProject(t, user, gin.H{"id": id, "title": "Renamed", "data": json.RawMessage(savedPipeline), "baseVersion": 1})
+	if status != http.StatusOK || res["version"] != 2.0 {
+		t.Fatalf("rename: %d %v, want version 2", status, res)
+	}
+	status, res = saveProject(t, user, gin.H{"id": id, "title": "Other name", "data": json.RawMessage(savedPipeline), "baseVersion": 1})
+	if status != http.StatusConflict {
+		t.Fatalf("concurrent rename: %d %v, want 409", status, res)
+	}
+
+	// an unchanged save doesn't
+	status, res = saveProject(t, user, gin.H{"id": id, "title": "Renamed", "data": json.RawMessage(savedPipeline), "baseVersion": 2})
+	if status != http.StatusOK || res["version"] != 2.0 {
+		t.Fatalf("unchanged save: %d %v, want version 2", status, res)
+	}
+}
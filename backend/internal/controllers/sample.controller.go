@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetProjectSamples(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var samples []models.ProjectSample
+	result := initializers.DB.Omit("Data").
+		Where("project_id = ?", project.ID).
+		Order("name").
+		Find(&samples)
+
+	if result.Error != nil {
+		fmt.Print("Failed to fetch samples: ", result.Error.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch samples"})
+		return
+	}
+
+	sampleInfos := make([]models.ProjectSampleInfo, len(samples))
+	for i := range samples {
+		sampleInfos[i] = projectSampleInfo(&samples[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"samples": sampleInfos,
+	})
+}
+
+// UploadProjectSamples adds the images in the multipart "images" field to a project's
+// samples, replacing samples of the same name
+func UploadProjectSamples(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		fmt.Print("Failed to parse form data")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form data"})
+		return
+	}
+	files := form.File["images"]
+	if len(files) == 0 {
+		fmt.Print("No images uploaded")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No images uploaded"})
+		return
+	}
+
+	uploads := make([]models.ProjectSample, 0, len(files))
+	for _, fileHeader := range files {
+		if fileHeader.Size > project_service.MaxSampleSize {
+			fmt.Print("Sample too large")
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is over %d MB", fileHeader.Filename, project_service.MaxSampleSize>>20)})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			fmt.Print("Failed to open uploaded file: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, project_service.MaxSampleSize+1))
+		file.Close()
+		if err != nil {
+			fmt.Print("Failed to read uploaded file: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+
+		name, contentType, err := project_service.CheckSample(fileHeader.Filename, data)
+		if err != nil {
+			fmt.Print("Invalid sample: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uploads = append(uploads, models.ProjectSample{
+			ProjectID:   project.ID,
+			Name:        name,
+			ContentType: contentType,
+			Size:        len(data),
+			Data:        data,
+		})
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range uploads {
+			if err := tx.Where("project_id = ? AND name = ?", project.ID, uploads[i].Name).Delete(&models.ProjectSample{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&uploads[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&models.ProjectSample{}).Where("project_id = ?", project.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > project_service.MaxSamplesPerProject {
+			return project_service.ErrInvalidSample
+		}
+		return nil
+	})
+	if errors.Is(err, project_service.ErrInvalidSample) {
+		fmt.Print("Too many samples")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A project can have at most %d samples", project_service.MaxSamplesPerProject)})
+		return
+	}
+	if err != nil {
+		fmt.Print("Failed to save samples: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save samples"})
+		return
+	}
+
+	sampleInfos := make([]models.ProjectSampleInfo, len(uploads))
+	for i := range uploads {
+		sampleInfos[i] = projectSampleInfo(&uploads[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Samples uploaded successfully",
+		"samples": sampleInfos,
+	})
+}
+
+func GetProjectSample(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	sample, ok := findProjectSample(c, project)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", sample.Name))
+	c.Data(http.StatusOK, sample.ContentType, sample.Data)
+}
+
+func DeleteProjectSample(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	sample, ok := findProjectSample(c, project)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(sample).Error; err != nil {
+		fmt.Print("Failed to delete sample: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sample"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sample deleted successfully",
+	})
+}
+
+// findProjectSample loads the sample in the :sampleId param of an already authorized project
+func findProjectSample(c *gin.Context, project *models.Project) (*models.ProjectSample, bool) {
+	var sampleID uint
+	if _, err := fmt.Sscanf(c.Param("sampleId"), "%d", &sampleID); err != nil {
+		fmt.Print("Invalid sample ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sample ID"})
+		return nil, false
+	}
+
+	var sample models.ProjectSample
+	result := initializers.DB.Where("id = ? AND project_id = ?", sampleID, project.ID).First(&sample)
+	if result.Error != nil {
+		fmt.Print("Sample not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sample not found"})
+		return nil, false
+	}
+
+	return &sample, true
+}
+
+func projectSampleInfo(sample *models.ProjectSample) models.ProjectSampleInfo {
+	return models.ProjectSampleInfo{
+		ID:          sample.ID,
+		Name:        sample.Name,
+		ContentType: sample.ContentType,
+		Size:        sample.Size,
+		CreatedAt:   sample.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
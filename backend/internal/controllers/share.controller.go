@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateShareLink mints a read-only link to a project for people without an account
+func CreateShareLink(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	// The body is optional, without one the link never expires
+	var input models.ShareLinkInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			fmt.Print("Error binding JSON: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+			return
+		}
+	}
+	if input.ExpiresInHours < 0 {
+		fmt.Print("Invalid expiry")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInHours cannot be negative"})
+		return
+	}
+	if input.ExpiresInHours > project_service.MaxShareLinkHours {
+		fmt.Print("Invalid expiry")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expiresInHours cannot be more than %d", project_service.MaxShareLinkHours)})
+		return
+	}
+
+	token, err := project_service.NewShareToken()
+	if err != nil {
+		fmt.Print("Failed to generate share token: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	link := models.ShareLink{
+		ProjectID:   project.ID,
+		Token:       token,
+		CreatedByID: currentUser.ID,
+	}
+	if input.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if err := initializers.DB.Create(&link).Error; err != nil {
+		fmt.Print("Failed to create share link: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Share link created successfully",
+		"shareLink": shareLinkInfo(&link),
+	})
+}
+
+// GetShareLinks lists a project's links that haven't been revoked or expired
+func GetShareLinks(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var links []models.ShareLink
+	result := initializers.DB.
+		Where("project_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", project.ID, time.Now()).
+		Order("created_at DESC").
+		Find(&links)
+
+	if result.Error != nil {
+		fmt.Print("Failed to fetch share links: ", result.Error.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links"})
+		return
+	}
+
+	linkInfos := make([]models.ShareLinkInfo, len(links))
+	for i := range links {
+		linkInfos[i] = shareLinkInfo(&links[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shareLinks": linkInfos,
+	})
+}
+
+func RevokeShareLink(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var linkID uint
+	if _, err := fmt.Sscanf(c.Param("linkId"), "%d", &linkID); err != nil {
+		fmt.Print("Invalid share link ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid share link ID"})
+		return
+	}
+
+	result := initializers.DB.Model(&models.ShareLink{}).
+		Where("id = ? AND project_id = ? AND revoked_at IS NULL", linkID, project.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		fmt.Print("Failed to revoke share link: ", result.Error.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		fmt.Print("Share link not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Share link revoked successfully",
+	})
+}
+
+// GetSharedProject is the one unauthenticated project route, the token is the credential
+func GetSharedProject(c *gin.Context) {
+	project, err := project_service.FindSharedProject(initializers.DB, c.Param("token"))
+	if errors.Is(err, project_service.ErrShareLinkInvalid) {
+		fmt.Print("Invalid share link")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		fmt.Print("Failed to load shared project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load shared project"})
+		return
+	}
+
+	data, ok := migratedData(c, project.Data)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project":  projectInfo(project, models.RoleViewer),
+		"data":     data,
+		"readOnly": true,
+	})
+}
+
+func shareLinkInfo(link *models.ShareLink) models.ShareLinkInfo {
+	info := models.ShareLinkInfo{
+		ID:        link.ID,
+		Token:     link.Token,
+		CreatedAt: link.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if link.ExpiresAt != nil {
+		info.ExpiresAt = link.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return info
+}
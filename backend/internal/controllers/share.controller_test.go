@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateShareLinkExpiry(t *testing.T) {
+	owner := testUser(t, "share-owner")
+	_, res := saveProject(t, owner, gin.H{"title": "Shared", "data": pipelineWith("shared")})
+	id := gin.Param{Key: "id", Value: fmt.Sprint(res["project"].(map[string]interface{})["id"])}
+
+	tests := []struct {
+		name    string
+		hours   int64
+		status  int
+		expires bool
+	}{
+		{"never", 0, http.StatusOK, false},
+		{"a day", 24, http.StatusOK, true},
+		{"a year", 8760, http.StatusOK, true},
+		{"over a year", 8761, http.StatusBadRequest, false},
+		{"overflows a duration", 1 << 40, http.StatusBadRequest, false},
+		{"negative", -1, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := call(t, CreateShareLink, owner, http.MethodPost, "/api/project/share", gin.H{"expiresInHours": tt.hours}, id)
+			if status != tt.status {
+				t.Fatalf("status = %d %v, want %d", status, res, tt.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			link := res["shareLink"].(map[string]interface{})
+			if expires := link["expiresAt"] != nil; expires != tt.expires {
+				t.Fatalf("link expires at %v, want an expiry %v", link["expiresAt"], tt.expires)
+			}
+		})
+	}
+}
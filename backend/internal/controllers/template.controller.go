@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTemplatePageSize = 24
+	maxTemplatePageSize     = 100
+)
+
+// PublishProject lists a project in the template gallery
+func PublishProject(c *gin.Context) {
+	project, role, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	// republishing keeps the original publish date
+	if !project.Published {
+		now := time.Now()
+		project.Published = true
+		project.PublishedAt = &now
+		if err := initializers.DB.Model(project).Select("Published", "PublishedAt").Updates(project).Error; err != nil {
+			fmt.Print("Failed to publish project: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish project"})
+			return
+		}
+	}
+	if err := initializers.DB.Model(project).Association("Tags").Find(&project.Tags); err != nil {
+		fmt.Print("Failed to load tags: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project published successfully",
+		"project": projectInfo(project, role),
+	})
+}
+
+// UnpublishProject takes a project out of the gallery. Projects already created from it
+// keep their reference to it.
+func UnpublishProject(c *gin.Context) {
+	project, role, ok := findProject(c, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	project.Published = false
+	project.PublishedAt = nil
+	if err := initializers.DB.Model(project).Select("Published", "PublishedAt").Updates(project).Error; err != nil {
+		fmt.Print("Failed to unpublish project: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpublish project"})
+		return
+	}
+	if err := initializers.DB.Model(project).Association("Tags").Find(&project.Tags); err != nil {
+		fmt.Print("Failed to load tags: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpublish project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project unpublished successfully",
+		"project": projectInfo(project, role),
+	})
+}
+
+// GetTemplates searches the gallery. Query params: q matches the title and description,
+// tag filters by tag, sort is popular (default), recent or title, plus limit and offset.
+func GetTemplates(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTemplatePageSize)))
+	if err != nil || limit < 1 || limit > maxTemplatePageSize {
+		fmt.Print("Invalid limit")
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxTemplatePageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		fmt.Print("Invalid offset")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	var order string
+	switch c.DefaultQuery("sort", "popular") {
+	case "popular":
+		order = "use_count DESC, published_at DESC"
+	case "recent":
+		order = "published_at DESC"
+	case "title":
+		order = "LOWER(title), published_at DESC"
+	default:
+		fmt.Print("Invalid sort")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be popular, recent or title"})
+		return
+	}
+
+	query := initializers.DB.Model(&models.Project{}).Where("published = ?", true)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		tagged := initializers.DB.Table("project_tags").
+			Select("project_tags.project_id").
+			Joins("JOIN tags ON tags.id = project_tags.tag_id").
+			Where("tags.name = ?", tag)
+		query = query.Where("id IN (?)", tagged)
+	}
+
+	// a fresh session so the count and the page don't share a statement
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		fmt.Print("Failed to count templates: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	var templates []models.Project
+	result := query.Omit("Data").
+		Preload("Tags").
+		Order(order).
+		Limit(limit).
+		Offset(offset).
+		Find(&templates)
+
+	if result.Error != nil {
+		fmt.Print("Failed to fetch templates: ", result.Error.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+
+	templateInfos := make([]models.TemplateInfo, len(templates))
+	for i := range templates {
+		templateInfos[i] = templateInfo(&templates[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templateInfos,
+		"total":     total,
+	})
+}
+
+// GetTemplate returns a published project with its pipeline so it can be previewed
+func GetTemplate(c *gin.Context) {
+	template, ok := findTemplate(c)
+	if !ok {
+		return
+	}
+
+	data, ok := migratedData(c, template.Data)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template": templateInfo(template),
+		"data":     data,
+	})
+}
+
+// UseTemplate copies a published project into the current user's projects. The copy
+// records the template it came from, and the template's use count goes up.
+func UseTemplate(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	template, ok := findTemplate(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional, without a title the project is named after the template
+	var input models.TemplateUseInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			fmt.Print("Error binding JSON: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+			return
+		}
+	}
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		title = template.Title
+	}
+
+	project := models.Project{
+		CreatorID:       currentUser.ID,
+		CreatorUsername: currentUser.Username,
+		Title:           title,
+		Description:     template.Description,
+		Data:            append(datatypes.JSON(nil), template.Data...),
+		Tags:            template.Tags,
+		TemplateID:      &template.ID,
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := project_service.SetParent(tx, &project, template); err != nil {
+			return err
+		}
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(template).UpdateColumn("use_count", gorm.Expr("use_count + 1")).Error; err != nil {
+			return err
+		}
+		_, err := project_service.RecordVersion(tx, &project, currentUser, fmt.Sprintf("Created from template %s", template.Title), false)
+		return err
+	})
+	if err != nil {
+		fmt.Print("Failed to use template: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to use template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Project created from template successfully",
+		"project": projectInfo(&project, models.RoleOwner),
+	})
+}
+
+// findTemplate loads the published project in the :id param along with its tags. Any
+// signed in user can see a template, whatever their role on the project.
+func findTemplate(c *gin.Context) (*models.Project, bool) {
+	var templateID uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &templateID); err != nil {
+		fmt.Print("Invalid template ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	var template models.Project
+	result := initializers.DB.Preload("Tags").Where("id = ? AND published = ?", templateID, true).First(&template)
+	if result.Error != nil {
+		fmt.Print("Template not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return nil, false
+	}
+
+	return &template, true
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func templateInfo(project *models.Project) models.TemplateInfo {
+	info := models.TemplateInfo{
+		ID:              project.ID,
+		CreatorUsername: project.CreatorUsername,
+		Title:           project.Title,
+		Description:     project.Description,
+		Tags:            project_service.TagNames(project.Tags),
+		UseCount:        project.UseCount,
+	}
+	if project.PublishedAt != nil {
+		info.PublishedAt = project.PublishedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return info
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/project_service"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetProjectVersions(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	var versions []models.ProjectVersion
+	result := initializers.DB.Omit("Data").
+		Where("project_id = ?", project.ID).
+		Order("version DESC").
+		Find(&versions)
+
+	if result.Error != nil {
+		fmt.Print("Failed to fetch versions: ", result.Error.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch versions"})
+		return
+	}
+
+	versionInfos := make([]models.ProjectVersionInfo, len(versions))
+	for i := range versions {
+		versionInfos[i] = projectVersionInfo(&versions[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": versionInfos,
+	})
+}
+
+func GetProjectVersion(c *gin.Context) {
+	project, _, ok := findProject(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	version, ok := findProjectVersion(c, project)
+	if !ok {
+		return
+	}
+
+	data, ok := migratedData(c, version.Data)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version": projectVersionInfo(version),
+		"data":    data,
+	})
+}
+
+// RestoreProjectVersion makes an old version the current state of the project. The
+// restore is itself saved as a new version, so it can be undone the same way.
+func RestoreProjectVersion(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		fmt.Print("User not authenticated")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	currentUser := user.(models.User)
+
+	project, role, ok := findProject(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	restored, ok := findProjectVersion(c, project)
+	if !ok {
+		return
+	}
+
+	// The body is optional, without one the restore isn't checked against the editor's copy
+	var input models.ProjectRestoreInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			fmt.Print("Error binding JSON: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+			return
+		}
+	}
+
+	var version *models.ProjectVersion
+	var latestVersion int
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		current, latest, err := project_service.LockForSave(tx, project.ID, input.BaseVersion, input.BaseUpdatedAt)
+		if err != nil {
+			if current != nil {
+				project, latestVersion = current, latest
+			}
+			return err
+		}
+		project = current
+
+		project.Data = restored.Data
+		if err := tx.Model(project).Update("data", project.Data).Error; err != nil {
+			return err
+		}
+		version, err = project_service.RecordVersion(tx, project, currentUser, fmt.Sprintf("Restored version %d", restored.Version), false)
+		return err
+	})
+	if errors.Is(err, project_service.ErrStaleSave) {
+		fmt.Print("Rejected stale restore of project ", project.ID)
+		data, ok := migratedData(c, project.Data)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Project was changed since it was loaded",
+			"project": projectInfo(project, role),
+			"data":    data,
+			"version": latestVersion,
+		})
+		return
+	}
+	if err != nil {
+		fmt.Print("Failed to restore version: ", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+
+	data, ok := migratedData(c, project.Data)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Version restored successfully",
+		"project": projectInfo(project, role),
+		"version": projectVersionInfo(version),
+		"data":    data,
+	})
+}
+
+// findProjectVersion loads the version in the :version param of an already authorized project
+func findProjectVersion(c *gin.Context, project *models.Project) (*models.ProjectVersion, bool) {
+	var versionNumber int
+	if _, err := fmt.Sscanf(c.Param("version"), "%d", &versionNumber); err != nil {
+		fmt.Print("Invalid version")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return nil, false
+	}
+
+	var version models.ProjectVersion
+	result := initializers.DB.Where("project_id = ? AND version = ?", project.ID, versionNumber).First(&version)
+	if result.Error != nil {
+		fmt.Print("Version not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return nil, false
+	}
+
+	return &version, true
+}
+
+func projectVersionInfo(version *models.ProjectVersion) models.ProjectVersionInfo {
+	return models.ProjectVersionInfo{
+		ID:             version.ID,
+		Version:        version.Version,
+		AuthorID:       version.AuthorID,
+		AuthorUsername: version.AuthorUsername,
+		Message:        version.Message,
+		Autosave:       version.Autosave,
+		CreatedAt:      version.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
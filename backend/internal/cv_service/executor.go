@@ -0,0 +1,100 @@
+package cv_service
+
+import (
+	"context"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Executor runs a pipeline over a batch of images, writing results into outputDir and
+// returning the paths of the images it produced. Images of captured nodes are written
+// under outputDir/nodes/<nodeID>/.
+type Executor interface {
+	Execute(ctx context.Context, inputPaths []string, outputDir string, pipeline models.PipelineData, capture Capture) ([]string, error)
+}
+
+// SubprocessExecutor starts the cv binary once per batch, passing the pipeline as JSON
+// on the command line
+type SubprocessExecutor struct {
+	BinaryPath string
+}
+
+func NewSubprocessExecutor(binaryPath string) *SubprocessExecutor {
+	return &SubprocessExecutor{BinaryPath: binaryPath}
+}
+
+// DefaultCvExePath is where the cv build lands when the backend is run from its own directory
+func DefaultCvExePath() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return filepath.Join("..", "cv", "build", "cv.exe")
+	}
+	return filepath.Join(cwd, "..", "cv", "build", "cv.exe")
+}
+
+func (e *SubprocessExecutor) Execute(ctx context.Context, inputPaths []string, outputDir string, pipeline models.PipelineData, capture Capture) ([]string, error) {
+	if len(inputPaths) == 0 {
+		return nil, nil
+	}
+
+	// Convert all paths to absolute paths
+	var absolutePaths []string
+	for _, path := range inputPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for %s: %v", path, err)
+		}
+		absolutePaths = append(absolutePaths, absPath)
+	}
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for output dir: %v", err)
+	}
+
+	pipelineJSONBytes, err := json.Marshal(pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pipeline: %v", err)
+	}
+	pipelineJSONString := string(pipelineJSONBytes)
+
+	args := []string{"--output", absOutputDir, "--input"}
+	args = append(args, absolutePaths...)
+	args = append(args, "--pipeline", pipelineJSONString)
+	if capture.All {
+		args = append(args, "--capture", "all")
+	} else if len(capture.NodeIDs) > 0 {
+		args = append(args, "--capture", strings.Join(capture.NodeIDs, ","))
+	}
+
+	// the context kills cv.exe when the job is cancelled or times out
+	cmd := exec.CommandContext(ctx, e.BinaryPath, args...)
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cv.exe failed: %v, output: %s", err, string(output))
+	}
+
+	// cv.exe writes each result under the input's file name
+	var outputFiles []string
+	for _, inputPath := range inputPaths {
+		outputPath := filepath.Join(outputDir, filepath.Base(inputPath))
+		if _, err := os.Stat(outputPath); err == nil {
+			outputFiles = append(outputFiles, outputPath)
+		}
+	}
+	if len(outputFiles) == 0 {
+		return nil, fmt.Errorf("cv.exe produced no images, output: %s", string(output))
+	}
+
+	return outputFiles, nil
+}
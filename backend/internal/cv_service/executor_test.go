@@ -0,0 +1,89 @@
+package cv_service
+
+import (
+	"context"
+	"edward-lemonade/chive/internal/models"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// fakeExecutor stands in for cv.exe in tests. Each test sets run to decide what the
+// jobs it submits do.
+type fakeExecutor struct {
+	mu    sync.Mutex
+	run   func(ctx context.Context, inputPaths []string, outputDir string) ([]string, error)
+	calls int
+}
+
+func (e *fakeExecutor) Execute(ctx context.Context, inputPaths []string, outputDir string, pipeline models.PipelineData, capture Capture) ([]string, error) {
+	e.mu.Lock()
+	run := e.run
+	e.calls++
+	e.mu.Unlock()
+
+	outputFiles, err := run(ctx, inputPaths, outputDir)
+	if err != nil || !capture.Enabled() {
+		return outputFiles, err
+	}
+	return outputFiles, captureNodes(outputDir, outputFiles, pipeline, capture)
+}
+
+// captureNodes saves every output image again as the image of each captured node,
+// under nodes/<nodeID>/ like cv.exe does
+func captureNodes(outputDir string, outputFiles []string, pipeline models.PipelineData, capture Capture) error {
+	for _, node := range pipeline.Nodes {
+		if !isSafeNodeDir(node.ID) || (!capture.All && !slices.Contains(capture.NodeIDs, node.ID)) {
+			continue
+		}
+		nodeDir := filepath.Join(outputDir, nodesDirName, node.ID)
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			return err
+		}
+		for _, outputPath := range outputFiles {
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(nodeDir, filepath.Base(outputPath)), data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// set replaces what the executor does and resets its call count
+func (e *fakeExecutor) set(run func(ctx context.Context, inputPaths []string, outputDir string) ([]string, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.run = run
+	e.calls = 0
+}
+
+func (e *fakeExecutor) callCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.calls
+}
+
+// copyInputs is an executor run that passes every image through unchanged, writing
+// results where cv.exe would
+func copyInputs(ctx context.Context, inputPaths []string, outputDir string) ([]string, error) {
+	var outputFiles []string
+	for _, inputPath := range inputPaths {
+		data, err := os.ReadFile(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		outputPath := filepath.Join(outputDir, filepath.Base(inputPath))
+		if err := os.WriteFile(outputPath, data, 0644); err != nil {
+			return nil, err
+		}
+		outputFiles = append(outputFiles, outputPath)
+	}
+	return outputFiles, nil
+}
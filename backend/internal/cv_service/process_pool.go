@@ -0,0 +1,463 @@
+package cv_service
+
+import (
+	"bufio"
+	"context"
+	"edward-lemonade/chive/internal/models"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ProcessPoolExecutor keeps a pool of long-lived `cv.exe --serve` processes and streams
+// work to them over stdin/stdout, instead of forking cv.exe and passing the pipeline on
+// the command line for every batch.
+//
+// Every message is a sequence of frames, each a 4-byte big-endian length followed by
+// that many bytes. A message starts with a JSON header frame:
+//
+//	-> {"type": "ping", "id": "..."}
+//	<- {"type": "pong", "id": "..."}
+//
+//	-> {"type": "process", "id": "...", "pipeline": {...}, "images": [{"name": "a.png"}, ...],
+//	    "capture": {"all": false, "nodeIds": [...]}}
+//	   followed by one frame of encoded image bytes per entry in images
+//	<- {"type": "result", "id": "...", "images": [{"name": "a.png", "nodes": ["n1"]}, {"name": "b.png", "error": "..."}]}
+//	   followed, for each image without an error, by a frame of its encoded output and then
+//	   one frame per captured node listed in its nodes
+//
+// Either side may answer with {"type": "error", "id": "...", "error": "..."} instead.
+type ProcessPoolExecutor struct {
+	BinaryPath string
+
+	idle chan *cvProcess
+	size int
+}
+
+const (
+	healthCheckInterval = 30 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	restartBackoff      = 2 * time.Second
+	// frames larger than this are treated as a corrupt stream
+	maxFrameSize = 256 << 20
+)
+
+// errProcessBroken wraps failures that leave a process unusable, as opposed to a
+// pipeline error the process reported cleanly
+var errProcessBroken = errors.New("cv process broken")
+
+type cvProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	exited chan struct{} // closed once the process has been reaped
+}
+
+type frameHeader struct {
+	Type     string               `json:"type"`
+	ID       string               `json:"id,omitempty"`
+	Pipeline *models.PipelineData `json:"pipeline,omitempty"`
+	Images   []frameImage         `json:"images,omitempty"`
+	Capture  *Capture             `json:"capture,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+type frameImage struct {
+	Name  string   `json:"name"`
+	Nodes []string `json:"nodes,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// imageOutput holds the frames returned for one image
+type imageOutput struct {
+	data  []byte
+	nodes [][]byte // lines up with frameImage.Nodes
+}
+
+// NewProcessPoolExecutor starts size cv processes. It fails if the first one cannot
+// start, so a bad binary path is caught at boot rather than on the first job.
+//
+// Every process is watched, and one that exits for any reason (crash, kill after a
+// cancelled job, failed health check) is replaced straight away. The watcher is the only
+// thing that starts replacements, so the pool never grows past size.
+func NewProcessPoolExecutor(binaryPath string, size int) (*ProcessPoolExecutor, error) {
+	e := &ProcessPoolExecutor{
+		BinaryPath: binaryPath,
+		idle:       make(chan *cvProcess, size),
+		size:       size,
+	}
+
+	for i := 0; i < size; i++ {
+		proc, err := e.start()
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			go e.replace()
+			continue
+		}
+		e.idle <- proc
+	}
+	go e.healthCheck()
+
+	log.Printf("Started %d cv worker processes from %s", size, binaryPath)
+	return e, nil
+}
+
+func (e *ProcessPoolExecutor) Execute(ctx context.Context, inputPaths []string, outputDir string, pipeline models.PipelineData, capture Capture) ([]string, error) {
+	if len(inputPaths) == 0 {
+		return nil, nil
+	}
+
+	header := frameHeader{
+		Type:     "process",
+		ID:       generateJobID(),
+		Pipeline: &pipeline,
+	}
+	if capture.Enabled() {
+		header.Capture = &capture
+	}
+	payloads := make([][]byte, 0, len(inputPaths))
+	for _, path := range inputPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input %s: %v", path, err)
+		}
+		header.Images = append(header.Images, frameImage{Name: filepath.Base(path)})
+		payloads = append(payloads, data)
+	}
+
+	proc, err := e.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// killing the process is the only way to interrupt it mid-request
+	stop := context.AfterFunc(ctx, proc.kill)
+	res, outputs, err := proc.roundTrip(header, payloads)
+	stop()
+
+	if err != nil && (ctx.Err() != nil || errors.Is(err, errProcessBroken)) {
+		proc.kill()
+	} else {
+		e.release(proc)
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// write the results out where HandleImageBatch expects them
+	var outputFiles []string
+	var failures []string
+	next := 0
+	for _, image := range res.Images {
+		if image.Error != "" {
+			log.Printf("cv process failed on %s: %s", image.Name, image.Error)
+			failures = append(failures, image.Name+": "+image.Error)
+			continue
+		}
+		if next >= len(outputs) {
+			break
+		}
+		output := outputs[next]
+		next++
+
+		name := filepath.Base(image.Name)
+		outputPath := filepath.Join(outputDir, name)
+		if err := os.WriteFile(outputPath, output.data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write output %s: %v", outputPath, err)
+		}
+		outputFiles = append(outputFiles, outputPath)
+
+		for i, nodeID := range image.Nodes {
+			if !isSafeNodeDir(nodeID) {
+				continue
+			}
+			nodeDir := filepath.Join(outputDir, nodesDirName, nodeID)
+			if err := os.MkdirAll(nodeDir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create node output directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(nodeDir, name), output.nodes[i], 0644); err != nil {
+				return nil, fmt.Errorf("failed to write output of node %s: %v", nodeID, err)
+			}
+		}
+	}
+
+	// some images failing still gives a result, all of them failing doesn't
+	if len(outputFiles) == 0 {
+		if len(failures) > 0 {
+			return nil, fmt.Errorf("cv process failed on every image: %s", strings.Join(failures, "; "))
+		}
+		return nil, errors.New("cv process returned no images")
+	}
+	return outputFiles, nil
+}
+
+// start launches a cv process and watches it for the rest of its life
+func (e *ProcessPoolExecutor) start() (*cvProcess, error) {
+	proc, err := startCvProcess(e.BinaryPath)
+	if err != nil {
+		return nil, err
+	}
+	go e.watch(proc)
+	return proc, nil
+}
+
+// watch replaces proc as soon as it exits. If it died while idle it is taken out of the
+// idle pool first, otherwise whoever is using it will see it broken and drop it.
+func (e *ProcessPoolExecutor) watch(proc *cvProcess) {
+	proc.wait()
+	e.dropIdle(proc)
+	log.Printf("cv worker process exited: %v", proc.cmd.ProcessState)
+	e.replace()
+}
+
+// dropIdle removes proc from the idle pool if it is there
+func (e *ProcessPoolExecutor) dropIdle(dead *cvProcess) {
+	var alive []*cvProcess
+	for {
+		select {
+		case proc := <-e.idle:
+			if proc != dead {
+				alive = append(alive, proc)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	for _, proc := range alive {
+		e.idle <- proc
+	}
+}
+
+// acquire waits for an idle process, skipping any that exited before their watcher got
+// to them
+func (e *ProcessPoolExecutor) acquire(ctx context.Context) (*cvProcess, error) {
+	for {
+		select {
+		case proc := <-e.idle:
+			select {
+			case <-proc.exited:
+				continue
+			default:
+				return proc, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release hands a process back to the idle pool, unless it has exited in the meantime
+func (e *ProcessPoolExecutor) release(proc *cvProcess) {
+	select {
+	case <-proc.exited:
+	default:
+		e.idle <- proc
+	}
+}
+
+// replace starts a process to take the place of one that exited, retrying until one starts
+func (e *ProcessPoolExecutor) replace() {
+	for {
+		proc, err := e.start()
+		if err == nil {
+			e.idle <- proc
+			log.Printf("Restarted cv worker process")
+			return
+		}
+		log.Printf("Failed to restart cv worker process: %v", err)
+		time.Sleep(restartBackoff)
+	}
+}
+
+// healthCheck pings idle processes and kills any that don't answer, which gets them replaced
+func (e *ProcessPoolExecutor) healthCheck() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for i := 0; i < e.size; i++ {
+			var proc *cvProcess
+			select {
+			case proc = <-e.idle:
+			default:
+			}
+			if proc == nil {
+				break // everything else is busy, which is healthy enough
+			}
+			select {
+			case <-proc.exited:
+				continue // its watcher is already replacing it
+			default:
+			}
+
+			if err := proc.ping(healthCheckTimeout); err != nil {
+				log.Printf("cv worker process failed health check: %v", err)
+				proc.kill()
+				continue
+			}
+			e.release(proc)
+		}
+	}
+}
+
+// ====================================================================================================
+// PROCESS
+
+func startCvProcess(binaryPath string) (*cvProcess, error) {
+	cmd := exec.Command(binaryPath, "--serve")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = log.Writer()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", binaryPath, err)
+	}
+
+	proc := &cvProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(proc.exited)
+	}()
+	return proc, nil
+}
+
+func (p *cvProcess) roundTrip(req frameHeader, payloads [][]byte) (*frameHeader, []imageOutput, error) {
+	headerBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	w := bufio.NewWriter(p.stdin)
+	if err := writeFrame(w, headerBytes); err != nil {
+		return nil, nil, err
+	}
+	for _, payload := range payloads {
+		if err := writeFrame(w, payload); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errProcessBroken, err)
+	}
+
+	frame, err := readFrame(p.stdout)
+	if err != nil {
+		return nil, nil, err
+	}
+	var res frameHeader
+	if err := json.Unmarshal(frame, &res); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid response header: %v", errProcessBroken, err)
+	}
+	if res.ID != req.ID {
+		return nil, nil, fmt.Errorf("%w: response for %q while waiting on %q", errProcessBroken, res.ID, req.ID)
+	}
+	if res.Type == "error" {
+		return nil, nil, fmt.Errorf("cv process error: %s", res.Error)
+	}
+
+	var outputs []imageOutput
+	for _, image := range res.Images {
+		if image.Error != "" {
+			continue
+		}
+		var output imageOutput
+		if output.data, err = readFrame(p.stdout); err != nil {
+			return nil, nil, err
+		}
+		for range image.Nodes {
+			node, err := readFrame(p.stdout)
+			if err != nil {
+				return nil, nil, err
+			}
+			output.nodes = append(output.nodes, node)
+		}
+		outputs = append(outputs, output)
+	}
+
+	return &res, outputs, nil
+}
+
+// ping checks that the process still answers. A process that doesn't answer in time is
+// killed, which is also what unblocks the read still waiting on its stdout.
+func (p *cvProcess) ping(timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := p.roundTrip(frameHeader{Type: "ping", ID: generateJobID()}, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		p.kill()
+		<-done
+		return errors.New("ping timed out")
+	}
+}
+
+func (p *cvProcess) kill() {
+	select {
+	case <-p.exited:
+	default:
+		p.cmd.Process.Kill()
+	}
+}
+
+func (p *cvProcess) wait() {
+	<-p.exited
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("%w: %v", errProcessBroken, err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("%w: %v", errProcessBroken, err)
+	}
+	return nil
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", errProcessBroken, err)
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("%w: frame of %d bytes is too large", errProcessBroken, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", errProcessBroken, err)
+	}
+	return payload, nil
+}
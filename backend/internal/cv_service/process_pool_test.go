@@ -0,0 +1,190 @@
+package cv_service
+
+import (
+	"bufio"
+	"context"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// poolHelperEnv makes the test binary act as `cv.exe --serve`, see serveHelper
+const poolHelperEnv = "CV_SERVE_HELPER"
+
+// serveHelper speaks the worker protocol on stdin/stdout. In "echo" mode it answers
+// pings and returns every image unchanged, failing the ones that read "corrupt". In
+// "hang" mode it never answers.
+func serveHelper(mode string) {
+	in := bufio.NewReader(os.Stdin)
+	out := bufio.NewWriter(os.Stdout)
+	for {
+		frame, err := readFrame(in)
+		if err != nil {
+			return
+		}
+		var req frameHeader
+		if err := json.Unmarshal(frame, &req); err != nil {
+			return
+		}
+		images := make([][]byte, len(req.Images))
+		for i := range req.Images {
+			if images[i], err = readFrame(in); err != nil {
+				return
+			}
+		}
+		if mode == "hang" {
+			select {}
+		}
+
+		res := frameHeader{Type: "pong", ID: req.ID}
+		var results [][]byte
+		if req.Type == "process" {
+			res = frameHeader{Type: "result", ID: req.ID, Images: req.Images}
+			for i, image := range images {
+				if string(image) == "corrupt" {
+					res.Images[i].Error = "failed to decode image"
+					continue
+				}
+				results = append(results, image)
+			}
+		}
+		header, _ := json.Marshal(res)
+		writeFrame(out, header)
+		for _, image := range results {
+			writeFrame(out, image)
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func startTestPool(t *testing.T, mode string, size int) *ProcessPoolExecutor {
+	t.Helper()
+	t.Setenv(poolHelperEnv, mode)
+	pool, err := NewProcessPoolExecutor(os.Args[0], size)
+	if err != nil {
+		t.Fatalf("NewProcessPoolExecutor: %v", err)
+	}
+	t.Cleanup(func() {
+		for i := 0; i < size; i++ {
+			select {
+			case proc := <-pool.idle:
+				proc.kill()
+			case <-time.After(time.Second):
+			}
+		}
+	})
+	return pool
+}
+
+// executeImages runs one image per content through the pool
+func executeImages(t *testing.T, pool *ProcessPoolExecutor, images ...string) ([]string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	var inputPaths []string
+	for i, image := range images {
+		inputPath := filepath.Join(dir, fmt.Sprintf("in%d.png", i))
+		if err := os.WriteFile(inputPath, []byte(image), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputPaths = append(inputPaths, inputPath)
+	}
+	outputDir := filepath.Join(dir, "out")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return pool.Execute(context.Background(), inputPaths, outputDir, models.PipelineData{}, Capture{})
+}
+
+func executeEcho(t *testing.T, pool *ProcessPoolExecutor, image string) {
+	t.Helper()
+	outputFiles, err := executeImages(t, pool, image)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(outputFiles) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(outputFiles))
+	}
+	output, err := os.ReadFile(outputFiles[0])
+	if err != nil || string(output) != image {
+		t.Fatalf("output = %q, %v, want %q", output, err, image)
+	}
+}
+
+func TestProcessPoolExecute(t *testing.T) {
+	pool := startTestPool(t, "echo", 1)
+	executeEcho(t, pool, "first")
+	executeEcho(t, pool, "second")
+}
+
+func TestProcessPoolImageFailures(t *testing.T) {
+	pool := startTestPool(t, "echo", 1)
+
+	outputFiles, err := executeImages(t, pool, "good", "corrupt")
+	if err != nil {
+		t.Fatalf("one bad image failed the whole batch: %v", err)
+	}
+	if len(outputFiles) != 1 || filepath.Base(outputFiles[0]) != "in0.png" {
+		t.Fatalf("outputs = %v, want only in0.png", outputFiles)
+	}
+
+	_, err = executeImages(t, pool, "corrupt", "corrupt")
+	if err == nil {
+		t.Fatal("a batch where every image failed succeeded")
+	}
+	for _, want := range []string{"in0.png: failed to decode image", "in1.png: failed to decode image"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+
+	// the process is still fine afterwards
+	executeEcho(t, pool, "after failures")
+}
+
+func TestProcessPoolReplacesCrashedWorker(t *testing.T) {
+	pool := startTestPool(t, "echo", 1)
+
+	crashed := <-pool.idle
+	pool.idle <- crashed
+	crashed.cmd.Process.Kill()
+	crashed.wait()
+
+	// the replacement shows up long before the next health check
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	proc, err := pool.acquire(ctx)
+	if err != nil {
+		t.Fatalf("crashed process was never replaced: %v", err)
+	}
+	if proc == crashed {
+		t.Fatal("crashed process was handed out again")
+	}
+	pool.release(proc)
+	executeEcho(t, pool, "after crash")
+}
+
+func TestProcessPingTimeoutKillsProcess(t *testing.T) {
+	t.Setenv(poolHelperEnv, "hang")
+	proc, err := startCvProcess(os.Args[0])
+	if err != nil {
+		t.Fatalf("startCvProcess: %v", err)
+	}
+
+	if err := proc.ping(100 * time.Millisecond); err == nil {
+		t.Fatal("ping of a hung process succeeded")
+	}
+	select {
+	case <-proc.exited:
+	case <-time.After(5 * time.Second):
+		proc.kill()
+		t.Fatal("hung process was left running after its ping timed out")
+	}
+}
@@ -1,47 +1,66 @@
 package cv_service
 
 import (
+	"context"
 	"edward-lemonade/chive/internal/models"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-
-	"github.com/google/uuid"
 )
 
 type ProcessingResult struct {
 	JobID       string
 	OutputFiles []string
+	NodeOutputs map[string][]string // intermediate images by node ID, when the job captured any
 	Error       error
 }
 
-var cvExePath string
+// Capture picks which nodes have the image they produce saved alongside the final
+// output. The zero value captures nothing.
+type Capture struct {
+	All     bool     `json:"all,omitempty"`
+	NodeIDs []string `json:"nodeIds,omitempty"`
+}
+
+func (c Capture) Enabled() bool {
+	return c.All || len(c.NodeIDs) > 0
+}
+
+// intermediate images go to <outputDir>/nodes/<nodeID>/<input file name>
+const nodesDirName = "nodes"
+
+var (
+	executor Executor = NewSubprocessExecutor(DefaultCvExePath())
+	// job input/ and output/ directories live under workDir
+	workDir = ".."
+)
 
-func init() {
-	cwd, err := os.Getwd()
+// CheckWorkDir makes sure dir exists and can be written to. Jobs can be picked up and
+// their results served by any backend instance, so dir has to be storage they all share.
+func CheckWorkDir(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("no work directory set")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create work directory: %v", err)
+	}
+	probe, err := os.CreateTemp(dir, ".probe-*")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("work directory is not writable: %v", err)
 	}
-	cvExePath = filepath.Join(cwd, "..", "cv", "build", "cv.exe")
+	probe.Close()
+	return os.Remove(probe.Name())
 }
 
-// handles the entire pipeline (internal, called by workers)
-func HandleImageBatch(uploadedFiles []io.Reader, filenames []string, pipeline models.PipelineData) (*ProcessingResult, error) {
-	jobID := uuid.New().String()
-
-	inputDir := filepath.Join("..", "input", jobID)
-	outputDir := filepath.Join("..", "output", jobID)
+// stageInputs copies the uploaded images into the job's input directory
+func stageInputs(jobID string, uploadedFiles []io.Reader, filenames []string) ([]string, error) {
+	inputDir := filepath.Join(workDir, "input", jobID)
 
 	if err := os.MkdirAll(inputDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create input directory: %v", err)
 	}
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %v", err)
-	}
 
 	// save uploaded files
 	var inputPaths []string
@@ -74,34 +93,80 @@ func HandleImageBatch(uploadedFiles []io.Reader, filenames []string, pipeline mo
 		return nil, fmt.Errorf("no valid image files provided")
 	}
 
+	return inputPaths, nil
+}
+
+// handles the entire pipeline on staged inputs (internal, called by workers)
+func HandleImageBatch(ctx context.Context, jobID string, inputPaths []string, pipeline models.PipelineData, capture Capture) (*ProcessingResult, error) {
+	outputDir := filepath.Join(workDir, "output", jobID)
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
 	// process images
-	err := executePipelineOnBatch(inputPaths, outputDir, pipeline)
+	outputFiles, err := executor.Execute(ctx, inputPaths, outputDir, pipeline, capture)
 	if err != nil {
-		CleanupJobFiles(jobID)
 		return nil, fmt.Errorf("processing failed: %v", err)
 	}
 
-	// collect output file paths
-	var outputFiles []string
-	for _, filename := range filenames {
-		if isImageFile(filename) {
-			outputPath := filepath.Join(outputDir, filename)
-			if _, err := os.Stat(outputPath); err == nil {
-				outputFiles = append(outputFiles, outputPath)
+	result := &ProcessingResult{
+		JobID:       jobID,
+		OutputFiles: outputFiles,
+	}
+	if capture.Enabled() {
+		result.NodeOutputs = collectNodeOutputs(outputDir)
+	}
+	return result, nil
+}
+
+// collectNodeOutputs lists the intermediate images an executor left under outputDir
+func collectNodeOutputs(outputDir string) map[string][]string {
+	nodesDir := filepath.Join(outputDir, nodesDirName)
+	nodeDirs, err := os.ReadDir(nodesDir)
+	if err != nil {
+		return nil
+	}
+
+	nodeOutputs := map[string][]string{}
+	for _, nodeDir := range nodeDirs {
+		if !nodeDir.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(nodesDir, nodeDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if !file.IsDir() && isImageFile(file.Name()) {
+				path := filepath.Join(nodesDir, nodeDir.Name(), file.Name())
+				nodeOutputs[nodeDir.Name()] = append(nodeOutputs[nodeDir.Name()], path)
 			}
 		}
 	}
+	return nodeOutputs
+}
 
-	return &ProcessingResult{
-		JobID:       jobID,
-		OutputFiles: outputFiles,
-	}, nil
+// isSafeNodeDir reports whether a node ID can be used as a directory name as is. Nodes
+// with other IDs are never captured.
+func isSafeNodeDir(nodeID string) bool {
+	if nodeID == "" || nodeID == "." || nodeID == ".." {
+		return false
+	}
+	for _, r := range nodeID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // CleanupJobFiles removes input and output directories for a job
 func CleanupJobFiles(jobID string) error {
-	inputDir := filepath.Join("..", "input", jobID)
-	outputDir := filepath.Join("..", "output", jobID)
+	inputDir := filepath.Join(workDir, "input", jobID)
+	outputDir := filepath.Join(workDir, "output", jobID)
 
 	var errs []error
 
@@ -119,47 +184,6 @@ func CleanupJobFiles(jobID string) error {
 	return nil
 }
 
-func executePipelineOnBatch(imagePaths []string, outputDir string, pipeline models.PipelineData) error {
-	if len(imagePaths) == 0 {
-		return nil
-	}
-
-	// Convert all paths to absolute paths
-	var absolutePaths []string
-	for _, path := range imagePaths {
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return fmt.Errorf("failed to get absolute path for %s: %v", path, err)
-		}
-		absolutePaths = append(absolutePaths, absPath)
-	}
-	absOutputDir, err := filepath.Abs(outputDir)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path for output dir: %v", err)
-	}
-
-	pipelineJSONBytes, err := json.Marshal(pipeline)
-	if err != nil {
-		return fmt.Errorf("failed to marshal pipeline string %s: %v", pipeline, err)
-	}
-	pipelineJSONString := string(pipelineJSONBytes)
-
-	fmt.Println(pipelineJSONString)
-
-	args := []string{"--output", absOutputDir, "--input"}
-	args = append(args, absolutePaths...)
-	args = append(args, "--pipeline", pipelineJSONString)
-
-	cmd := exec.Command(cvExePath, args...)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		return fmt.Errorf("cv.exe failed: %v, output: %s", err, string(output))
-	}
-
-	return nil
-}
-
 func isImageFile(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	return ext == ".png" || ext == ".jpg" || ext == ".jpeg" || ext == ".bmp"
@@ -0,0 +1,131 @@
+package cv_service
+
+import (
+	"bytes"
+	"context"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// capturePipeline is source -> blur -> output, with one node whose ID can't be a directory
+const capturePipeline = `{"nodes":[
+	{"id":"source","data":{"name":"Source","cvNodeType":"source"}},
+	{"id":"blur-1","data":{"name":"Blur","cvNodeType":"blur"}},
+	{"id":"../escape","data":{"name":"Blur","cvNodeType":"blur"}},
+	{"id":"output","data":{"name":"Output","cvNodeType":"output"}}
+],"edges":[]}`
+
+func submitCaptureJob(t *testing.T, capture Capture) *Job {
+	t.Helper()
+	var pipeline models.PipelineData
+	if err := json.Unmarshal([]byte(capturePipeline), &pipeline); err != nil {
+		t.Fatal(err)
+	}
+	job, err := SubmitJob(context.Background(), JobRequest{
+		UserID:        1,
+		Priority:      PriorityInteractive,
+		UploadedFiles: []io.Reader{bytes.NewReader([]byte("one")), bytes.NewReader([]byte("two"))},
+		Filenames:     []string{"a.png", "b.png"},
+		Pipeline:      pipeline,
+		Capture:       capture,
+	})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	t.Cleanup(func() { RemoveJob(job.ID) })
+	return job
+}
+
+func TestCaptureNodeOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		capture Capture
+		want    []string
+	}{
+		{"nothing", Capture{}, nil},
+		{"all", Capture{All: true}, []string{"blur-1", "output", "source"}},
+		{"listed nodes", Capture{NodeIDs: []string{"output", "blur-1"}}, []string{"blur-1", "output"}},
+		{"unsafe and unknown ids", Capture{NodeIDs: []string{"../escape", "blur-1", "missing"}}, []string{"blur-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testExecutor.set(copyInputs)
+			job := submitCaptureJob(t, tt.capture)
+
+			status := waitDone(t, job)
+			if status.State != JobSucceeded {
+				t.Fatalf("job finished %s (%v)", status.State, status.Error)
+			}
+			if strings.Join(status.CapturedNodes, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("captured %v, want %v", status.CapturedNodes, tt.want)
+			}
+
+			result := job.Result()
+			if len(result.NodeOutputs) != len(tt.want) {
+				t.Fatalf("node outputs = %v, want %v", result.NodeOutputs, tt.want)
+			}
+			outputDir := filepath.Join(workDir, "output", job.ID)
+			for _, nodeID := range tt.want {
+				paths := result.NodeOutputs[nodeID]
+				if len(paths) != 2 {
+					t.Fatalf("node %s has images %v, want one per input", nodeID, paths)
+				}
+				for _, path := range paths {
+					if filepath.Dir(path) != filepath.Join(outputDir, nodesDirName, nodeID) {
+						t.Fatalf("node %s image %s is outside its directory", nodeID, path)
+					}
+					if _, err := os.Stat(path); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if _, err := os.Stat(filepath.Join(outputDir, "escape")); !os.IsNotExist(err) {
+				t.Fatalf("node with an unsafe ID was captured: %v", err)
+			}
+		})
+	}
+}
+
+func TestCollectNodeOutputs(t *testing.T) {
+	outputDir := t.TempDir()
+	files := map[string]string{
+		"final.png":                "final images aren't node outputs",
+		"nodes/blur/a.png":         "a",
+		"nodes/blur/b.jpg":         "b",
+		"nodes/blur/notes.txt":     "not an image",
+		"nodes/blur/nested/c.png":  "too deep",
+		"nodes/output/a.png":       "a",
+		"nodes/stray.png":          "not in a node directory",
+		"nodes/empty/.placeholder": "",
+	}
+	for name, contents := range files {
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputs := collectNodeOutputs(outputDir)
+	if len(outputs) != 2 {
+		t.Fatalf("collected %v, want blur and output", outputs)
+	}
+	blur := outputs["blur"]
+	if len(blur) != 2 || filepath.Base(blur[0]) != "a.png" || filepath.Base(blur[1]) != "b.jpg" {
+		t.Fatalf("blur images = %v", blur)
+	}
+	if len(outputs["output"]) != 1 {
+		t.Fatalf("output images = %v", outputs["output"])
+	}
+
+	if outputs := collectNodeOutputs(t.TempDir()); outputs != nil {
+		t.Fatalf("collected %v from a job that captured nothing", outputs)
+	}
+}
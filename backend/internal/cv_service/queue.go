@@ -1,38 +1,139 @@
 package cv_service
 
 import (
+	"context"
+	"edward-lemonade/chive/internal/initializers"
 	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-type Job struct {
-	ID            string
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+const (
+	// finished jobs (and their output files) are kept around this long for the client to fetch
+	jobRetention = 30 * time.Minute
+	// a running job is killed once it has been going for this long
+	jobTimeout = 5 * time.Minute
+	// how long SubmitJob waits for a free slot before giving up with ErrQueueFull
+	submitWait = 2 * time.Second
+)
+
+// ErrQueueFull is returned by SubmitJob when the queue stayed full for submitWait
+var ErrQueueFull = errors.New("cv processing queue is full")
+
+type QueueConfig struct {
+	Workers        int
+	QueueSize      int
+	MaxJobsPerUser int      // running jobs allowed per user at once, 0 for no cap
+	Executor       Executor // defaults to running cv.exe from DefaultCvExePath
+	WorkDir        string   // where job input/ and output/ directories go, shared by every instance
+}
+
+// JobRequest is everything needed to submit a job
+type JobRequest struct {
+	UserID        uint
+	Priority      Priority
 	UploadedFiles []io.Reader
 	Filenames     []string
 	Pipeline      models.PipelineData
-	ResultChan    chan *ProcessingResult // Channel to send result back
+	Capture       Capture
+}
+
+type Job struct {
+	ID         string
+	UserID     uint
+	Priority   Priority
+	InputPaths []string
+	Pipeline   models.PipelineData
+	Capture    Capture
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	state       JobState
+	submittedAt time.Time
+	startedAt   time.Time
+	finishedAt  time.Time
+	result      *ProcessingResult
+	done        chan struct{} // closed once the job reaches a final state
+	remote      bool          // running on another instance, state is mirrored from cv_jobs
+}
+
+// QueueStats is a point-in-time snapshot of the worker pool
+type QueueStats struct {
+	Depth       int // jobs waiting for a worker
+	Capacity    int
+	Workers     int
+	BusyWorkers int
+	RetryAfter  time.Duration // rough guess at when a slot frees up
+}
+
+// JobStatus is a point-in-time snapshot of a job
+type JobStatus struct {
+	ID            string
+	State         JobState
+	QueuePosition int // 1-based, 0 once the job has left the queue
+	SubmittedAt   time.Time
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Error         error
+	OutputCount   int
+	CapturedNodes []string // IDs of nodes with intermediate images, sorted
 }
 
 var (
-	jobQueue      chan *Job
+	sched         *scheduler
 	workers       int
 	queueInitOnce sync.Once
+
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+
+	busyWorkers atomic.Int32
+	avgRunNanos atomic.Int64 // moving average of job run time, 0 until a job finishes
 )
 
-func InitQueue(numWorkers int, queueSize int) {
+func InitQueue(config QueueConfig) {
 	queueInitOnce.Do(func() {
-		workers = numWorkers
-		jobQueue = make(chan *Job, queueSize)
+		workers = config.Workers
+		sched = newScheduler(config.QueueSize, config.MaxJobsPerUser)
+		if config.Executor != nil {
+			executor = config.Executor
+		}
+		if config.WorkDir != "" {
+			workDir = config.WorkDir
+		}
+
+		recoverOrphans()
 
 		for i := 0; i < workers; i++ {
 			go worker(i)
 		}
+		go janitor()
+		go heartbeat()
+		go poll()
 
-		log.Printf("Initialized CV processing queue with %d workers and buffer size %d", numWorkers, queueSize)
+		log.Printf("Initialized CV processing queue with %d workers, buffer size %d and %d jobs per user",
+			config.Workers, config.QueueSize, config.MaxJobsPerUser)
 	})
 }
 
@@ -40,17 +141,58 @@ func InitQueue(numWorkers int, queueSize int) {
 func worker(id int) {
 	log.Printf("CV Worker %d started", id)
 
-	for job := range jobQueue {
+	workerID := fmt.Sprintf("%s/%d", instanceID, id)
+
+	for {
+		job := sched.next()
+
+		claimed, err := claimJobRecord(job.ID, workerID)
+		if err != nil {
+			log.Printf("Worker %d failed to claim job %s: %v", id, job.ID, err)
+			if job.start() {
+				job.finish(&ProcessingResult{JobID: job.ID, Error: fmt.Errorf("failed to claim job: %v", err)})
+				saveJobRecord(job)
+			}
+			sched.done(job)
+			continue
+		}
+		if !claimed {
+			// cancelled, or another instance got to it first
+			if job.Status().State == JobQueued {
+				job.setRemote()
+				go watchRecord(job)
+			}
+			sched.done(job)
+			continue
+		}
+		if !job.start() {
+			// cancelled locally while it was being claimed
+			saveJobRecord(job)
+			sched.done(job)
+			continue
+		}
 		log.Printf("Worker %d processing job %s", id, job.ID)
 
+		busyWorkers.Add(1)
+		started := time.Now()
 		result := processJob(job)
-		job.ResultChan <- result
+		recordRunTime(time.Since(started))
+		busyWorkers.Add(-1)
+		job.finish(result)
+		saveJobRecord(job)
+		sched.done(job)
 
-		log.Printf("Worker %d completed job %s", id, job.ID)
+		log.Printf("Worker %d completed job %s (%s)", id, job.ID, job.Status().State)
 	}
 }
 func processJob(job *Job) *ProcessingResult {
-	result, err := HandleImageBatch(job.UploadedFiles, job.Filenames, job.Pipeline)
+	ctx, cancel := context.WithTimeout(job.ctx, jobTimeout)
+	defer cancel()
+
+	result, err := HandleImageBatch(ctx, job.ID, job.InputPaths, job.Pipeline, job.Capture)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("processing timed out after %v", jobTimeout)
+	}
 	if err != nil {
 		return &ProcessingResult{
 			JobID: job.ID,
@@ -60,22 +202,365 @@ func processJob(job *Job) *ProcessingResult {
 	return result
 }
 
-// SubmitJob adds a job to the queue and returns a channel to receive the result
-func SubmitJob(uploadedFiles []io.Reader, filenames []string, pipeline models.PipelineData) (*Job, error) {
+// janitor drops finished jobs once they are past jobRetention and requeues orphans
+func janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		recoverOrphans()
+
+		var expired []string
+		err := initializers.DB.Model(&models.CvJob{}).
+			Where("finished_at < ?", time.Now().Add(-jobRetention)).
+			Pluck("id", &expired).Error
+		if err != nil {
+			log.Printf("Failed to look up expired jobs: %v", err)
+		}
+
+		jobsMu.Lock()
+		all := make([]*Job, 0, len(jobs))
+		for _, job := range jobs {
+			all = append(all, job)
+		}
+		jobsMu.Unlock()
+
+		for _, job := range all {
+			if finishedAt := job.Status().FinishedAt; !finishedAt.IsZero() && time.Since(finishedAt) > jobRetention {
+				expired = append(expired, job.ID)
+			}
+		}
+
+		for _, id := range expired {
+			RemoveJob(id)
+		}
+	}
+}
+
+// SubmitJob stages the uploaded files on disk and adds a job to the queue. The readers
+// are fully consumed before SubmitJob returns, so callers can close them right after.
+// Cancelling ctx cancels the job, killing cv.exe if it is already running.
+//
+// If the queue is full SubmitJob waits up to submitWait for a slot and then returns
+// ErrQueueFull, it never blocks indefinitely.
+func SubmitJob(ctx context.Context, req JobRequest) (*Job, error) {
+	if err := sched.reserve(ctx); err != nil {
+		return nil, err
+	}
+
+	jobID := generateJobID()
+
+	inputPaths, err := stageInputs(jobID, req.UploadedFiles, req.Filenames)
+	if err != nil {
+		sched.release()
+		return nil, err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
 	job := &Job{
-		ID:            generateJobID(),
-		UploadedFiles: uploadedFiles,
-		Filenames:     filenames,
-		Pipeline:      pipeline,
-		ResultChan:    make(chan *ProcessingResult, 1), // Buffered channel
+		ctx:         jobCtx,
+		cancel:      cancel,
+		ID:          jobID,
+		UserID:      req.UserID,
+		Priority:    req.Priority,
+		InputPaths:  inputPaths,
+		Pipeline:    req.Pipeline,
+		Capture:     safeCapture(req.Capture),
+		state:       JobQueued,
+		submittedAt: time.Now(),
+		done:        make(chan struct{}),
 	}
 
-	jobQueue <- job
+	if err := insertJobRecord(job); err != nil {
+		cancel()
+		CleanupJobFiles(jobID)
+		sched.release()
+		return nil, fmt.Errorf("failed to record job: %v", err)
+	}
+
+	jobsMu.Lock()
+	jobs[job.ID] = job
+	jobsMu.Unlock()
+
+	sched.push(job)
+
+	// jobs cancelled while still queued never reach a worker, so finish them here
+	context.AfterFunc(jobCtx, job.cancelQueued)
+
 	log.Printf("Job %s added to queue", job.ID)
 
 	return job, nil
 }
 
+// safeCapture drops node IDs that can't be captured because they don't make usable
+// directory names
+func safeCapture(capture Capture) Capture {
+	safe := Capture{All: capture.All}
+	for _, nodeID := range capture.NodeIDs {
+		if isSafeNodeDir(nodeID) {
+			safe.NodeIDs = append(safe.NodeIDs, nodeID)
+		} else {
+			log.Printf("Not capturing node %q, its ID is not a valid directory name", nodeID)
+		}
+	}
+	return safe
+}
+
+// Stats reports queue depth and worker utilization
+func Stats() QueueStats {
+	depth := sched.depth()
+
+	stats := QueueStats{
+		Depth:       depth,
+		Capacity:    cap(sched.slots),
+		Workers:     workers,
+		BusyWorkers: int(busyWorkers.Load()),
+	}
+
+	// every worker needs to get through its share of the queue before a slot frees up
+	avgRun := time.Duration(avgRunNanos.Load())
+	if avgRun == 0 {
+		avgRun = 5 * time.Second
+	}
+	if workers > 0 {
+		stats.RetryAfter = avgRun * time.Duration(depth/workers+1)
+	}
+	return stats
+}
+
+func recordRunTime(d time.Duration) {
+	// exponential moving average, weighted towards older runs
+	for {
+		old := avgRunNanos.Load()
+		next := int64(d)
+		if old != 0 {
+			next = (old*4 + int64(d)) / 5
+		}
+		if avgRunNanos.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// GetJob looks up a job that has not been removed yet, including jobs submitted to
+// other instances
+func GetJob(jobID string) (*Job, bool) {
+	if job, ok := localJob(jobID); ok {
+		return job, true
+	}
+
+	record, err := loadJobRecord(jobID)
+	if err != nil {
+		return nil, false
+	}
+	job, err := jobFromRecord(record)
+	if err != nil {
+		return nil, false
+	}
+	return job, true
+}
+
+// localJob looks up a job known to this instance
+func localJob(jobID string) (*Job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	job, ok := jobs[jobID]
+	return job, ok
+}
+
+// RemoveJob forgets a job and deletes its files and record
+func RemoveJob(jobID string) {
+	jobsMu.Lock()
+	delete(jobs, jobID)
+	jobsMu.Unlock()
+
+	if err := CleanupJobFiles(jobID); err != nil {
+		log.Printf("Failed to clean up job %s: %v", jobID, err)
+	}
+	deleteJobRecord(jobID)
+}
+
+// Done is closed once the job has succeeded, failed or been cancelled
+func (job *Job) Done() <-chan struct{} {
+	return job.done
+}
+
+// Result returns the processing result, or nil while the job is still pending
+func (job *Job) Result() *ProcessingResult {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return job.result
+}
+
+func (job *Job) Status() JobStatus {
+	if job.isRemote() {
+		job.refresh()
+	}
+
+	job.mu.Lock()
+	status := JobStatus{
+		ID:          job.ID,
+		State:       job.state,
+		SubmittedAt: job.submittedAt,
+		StartedAt:   job.startedAt,
+		FinishedAt:  job.finishedAt,
+	}
+	if job.result != nil {
+		status.Error = job.result.Error
+		status.OutputCount = len(job.result.OutputFiles)
+		for nodeID := range job.result.NodeOutputs {
+			status.CapturedNodes = append(status.CapturedNodes, nodeID)
+		}
+		sort.Strings(status.CapturedNodes)
+	}
+	job.mu.Unlock()
+
+	if status.State == JobQueued {
+		status.QueuePosition = sched.position(job)
+	}
+	return status
+}
+
+// Cancel stops the job, whether it is still queued or already running. It is a no-op
+// for jobs that have already finished.
+func (job *Job) Cancel() {
+	if job.isRemote() {
+		if err := requestCancel(job.ID); err != nil {
+			log.Printf("Failed to cancel job %s: %v", job.ID, err)
+		}
+		return
+	}
+	job.cancel()
+}
+
+func (job *Job) isRemote() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return job.remote
+}
+
+func (job *Job) setRemote() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.remote = true
+}
+
+// refresh reloads a remote job's state from its row
+func (job *Job) refresh() {
+	select {
+	case <-job.done:
+		return
+	default:
+	}
+
+	record, err := loadJobRecord(job.ID)
+	if err != nil {
+		return
+	}
+	job.applyRecord(record)
+}
+
+// applyRecord copies the state of a row onto a remote job, and reports whether the
+// job is finished
+func (job *Job) applyRecord(record *models.CvJob) bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.state = JobState(record.State)
+	job.submittedAt = record.SubmittedAt
+	if record.StartedAt != nil {
+		job.startedAt = *record.StartedAt
+	}
+	if record.FinishedAt != nil {
+		job.finishedAt = *record.FinishedAt
+	}
+
+	switch job.state {
+	case JobSucceeded, JobFailed, JobCancelled:
+	default:
+		return false
+	}
+
+	result := &ProcessingResult{JobID: job.ID}
+	if len(record.OutputFiles) > 0 {
+		json.Unmarshal(record.OutputFiles, &result.OutputFiles)
+	}
+	if len(record.NodeOutputs) > 0 {
+		json.Unmarshal(record.NodeOutputs, &result.NodeOutputs)
+	}
+	if record.Error != "" {
+		result.Error = errors.New(record.Error)
+	}
+	job.result = result
+
+	select {
+	case <-job.done:
+	default:
+		close(job.done)
+	}
+	return true
+}
+
+// start moves a queued job to running. It returns false if the job was cancelled first.
+func (job *Job) start() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if job.state != JobQueued {
+		return false
+	}
+	job.state = JobRunning
+	job.startedAt = time.Now()
+	return true
+}
+
+func (job *Job) finish(result *ProcessingResult) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.result = result
+	job.finishedAt = time.Now()
+	switch {
+	case errors.Is(job.ctx.Err(), context.Canceled):
+		job.state = JobCancelled
+		job.result = &ProcessingResult{JobID: job.ID, Error: errors.New("job cancelled")}
+		job.removeFiles()
+	case result.Error != nil:
+		job.state = JobFailed
+	default:
+		job.state = JobSucceeded
+	}
+	job.cancel()
+	close(job.done)
+}
+
+func (job *Job) cancelQueued() {
+	job.mu.Lock()
+	if job.state != JobQueued || job.remote {
+		job.mu.Unlock()
+		return
+	}
+	sched.remove(job)
+	job.state = JobCancelled
+	job.finishedAt = time.Now()
+	job.result = &ProcessingResult{JobID: job.ID, Error: errors.New("job cancelled")}
+	close(job.done)
+	job.mu.Unlock()
+
+	job.removeFiles()
+	saveJobRecord(job)
+}
+
+func (job *Job) removeFiles() {
+	if err := CleanupJobFiles(job.ID); err != nil {
+		log.Printf("Failed to clean up job %s: %v", job.ID, err)
+	}
+}
+
 func generateJobID() string {
 	return uuid.New().String()
 }
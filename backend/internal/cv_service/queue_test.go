@@ -0,0 +1,228 @@
+package cv_service
+
+import (
+	"bytes"
+	"context"
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testExecutor = &fakeExecutor{run: copyInputs}
+
+// TestMain runs the queue against an in-memory database and the fake executor, with a
+// single worker so tests control what is running. It also lets the test binary stand in
+// for cv.exe in the process pool tests.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(poolHelperEnv); mode != "" {
+		serveHelper(mode)
+		os.Exit(0)
+	}
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	// every connection to :memory: is its own database
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.CvJob{}); err != nil {
+		log.Fatal("Failed to migrate test database: ", err)
+	}
+	initializers.DB = db
+
+	dir, err := os.MkdirTemp("", "cv_service_test")
+	if err != nil {
+		log.Fatal("Failed to create work directory: ", err)
+	}
+	InitQueue(QueueConfig{
+		Workers:   1,
+		QueueSize: 4,
+		Executor:  testExecutor,
+		WorkDir:   dir,
+	})
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func submitTestJob(t *testing.T, ctx context.Context, image string) *Job {
+	t.Helper()
+	job, err := SubmitJob(ctx, JobRequest{
+		UserID:        1,
+		Priority:      PriorityInteractive,
+		UploadedFiles: []io.Reader{bytes.NewReader([]byte(image))},
+		Filenames:     []string{"image.png"},
+	})
+	if err != nil {
+		t.Fatalf("SubmitJob: %v", err)
+	}
+	t.Cleanup(func() { RemoveJob(job.ID) })
+	return job
+}
+
+func waitDone(t *testing.T, job *Job) JobStatus {
+	t.Helper()
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job %s never finished, state %s", job.ID, job.Status().State)
+	}
+	return job.Status()
+}
+
+func waitSignal(t *testing.T, signal <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-signal:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// assertRecord checks the job's row, which saveJobRecord writes right after the job
+// finishes
+func assertRecord(t *testing.T, jobID string, state JobState, errorText string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := loadJobRecord(jobID)
+		if err != nil {
+			t.Fatalf("load record: %v", err)
+		}
+		if record.State == string(state) {
+			if !strings.Contains(record.Error, errorText) {
+				t.Fatalf("record error = %q, want it to contain %q", record.Error, errorText)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("record state = %s, want %s", record.State, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubmitJobSucceeds(t *testing.T) {
+	testExecutor.set(copyInputs)
+
+	job := submitTestJob(t, context.Background(), "pixels")
+	status := waitDone(t, job)
+
+	if status.State != JobSucceeded {
+		t.Fatalf("state = %s (%v), want succeeded", status.State, status.Error)
+	}
+	if status.OutputCount != 1 {
+		t.Fatalf("output count = %d, want 1", status.OutputCount)
+	}
+	output, err := os.ReadFile(job.Result().OutputFiles[0])
+	if err != nil || string(output) != "pixels" {
+		t.Fatalf("output = %q, %v", output, err)
+	}
+	assertRecord(t, job.ID, JobSucceeded, "")
+}
+
+func TestSubmitJobFails(t *testing.T) {
+	testExecutor.set(func(ctx context.Context, inputPaths []string, outputDir string) ([]string, error) {
+		return nil, errors.New("cv.exe exploded")
+	})
+
+	job := submitTestJob(t, context.Background(), "pixels")
+	status := waitDone(t, job)
+
+	if status.State != JobFailed {
+		t.Fatalf("state = %s, want failed", status.State)
+	}
+	if status.Error == nil || !strings.Contains(status.Error.Error(), "cv.exe exploded") {
+		t.Fatalf("error = %v, want the executor's error", status.Error)
+	}
+	assertRecord(t, job.ID, JobFailed, "cv.exe exploded")
+}
+
+func TestSubmitJobCancelWhileRunning(t *testing.T) {
+	started := make(chan struct{})
+	testExecutor.set(func(ctx context.Context, inputPaths []string, outputDir string) ([]string, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	job := submitTestJob(t, context.Background(), "pixels")
+	waitSignal(t, started, "the job to start")
+	job.Cancel()
+	status := waitDone(t, job)
+
+	if status.State != JobCancelled {
+		t.Fatalf("state = %s, want cancelled", status.State)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "input", job.ID)); !os.IsNotExist(err) {
+		t.Fatalf("input files of a cancelled job were kept: %v", err)
+	}
+	assertRecord(t, job.ID, JobCancelled, "job cancelled")
+}
+
+func TestSubmitJobCancelWhileQueued(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	testExecutor.set(func(ctx context.Context, inputPaths []string, outputDir string) ([]string, error) {
+		started <- struct{}{}
+		<-release
+		return copyInputs(ctx, inputPaths, outputDir)
+	})
+
+	// the only worker is busy with the first job, so the second one waits in the queue
+	first := submitTestJob(t, context.Background(), "first")
+	waitSignal(t, started, "the first job to start")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	second := submitTestJob(t, ctx, "second")
+	if status := second.Status(); status.State != JobQueued || status.QueuePosition != 1 {
+		t.Fatalf("second job is %s at position %d, want queued at 1", status.State, status.QueuePosition)
+	}
+
+	cancel()
+	if status := waitDone(t, second); status.State != JobCancelled {
+		t.Fatalf("second job state = %s, want cancelled", status.State)
+	}
+	assertRecord(t, second.ID, JobCancelled, "job cancelled")
+
+	close(release)
+	if status := waitDone(t, first); status.State != JobSucceeded {
+		t.Fatalf("first job state = %s (%v), want succeeded", status.State, status.Error)
+	}
+	if calls := testExecutor.callCount(); calls != 1 {
+		t.Fatalf("executor ran %d times, want once", calls)
+	}
+	if depth := Stats().Depth; depth != 0 {
+		t.Fatalf("queue depth = %d after cancelling, want 0", depth)
+	}
+}
+
+func TestSubmitJobRejectsNonImages(t *testing.T) {
+	_, err := SubmitJob(context.Background(), JobRequest{
+		UserID:        1,
+		UploadedFiles: []io.Reader{strings.NewReader("#!/bin/sh")},
+		Filenames:     []string{"script.sh"},
+	})
+	if err == nil {
+		t.Fatal("SubmitJob accepted a job without images")
+	}
+	if free := len(sched.slots); free != cap(sched.slots) {
+		t.Fatalf("%d of %d queue slots free after a rejected job", free, cap(sched.slots))
+	}
+}
@@ -0,0 +1,259 @@
+package cv_service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority picks the scheduler lane a job waits in
+type Priority int
+
+const (
+	PriorityBatch       Priority = iota // large exports, can wait
+	PriorityInteractive                 // small editor previews, served first
+)
+
+// after this many interactive jobs in a row, a waiting batch job gets a turn
+const interactiveBurst = 3
+
+// scheduler hands queued jobs to workers. Each priority has its own lane, and within a
+// lane users are served round-robin so one big uploader can't starve everyone else.
+type scheduler struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	lanes      [2]*lane     // indexed by Priority
+	running    map[uint]int // running jobs per user
+	burst      int          // interactive jobs picked in a row while batch jobs waited
+	size       int
+	maxPerUser int           // 0 means no cap
+	slots      chan struct{} // one token per free queue slot
+}
+
+// lane holds the queued jobs of one priority, bucketed per user
+type lane struct {
+	users   []uint // users with pending jobs, in round-robin order
+	pending map[uint][]*Job
+	next    int // index into users of whoever goes next
+}
+
+func newScheduler(capacity int, maxPerUser int) *scheduler {
+	s := &scheduler{
+		lanes:      [2]*lane{newLane(), newLane()},
+		running:    map[uint]int{},
+		maxPerUser: maxPerUser,
+		slots:      make(chan struct{}, capacity),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := 0; i < capacity; i++ {
+		s.slots <- struct{}{}
+	}
+	return s
+}
+
+func newLane() *lane {
+	return &lane{pending: map[uint][]*Job{}}
+}
+
+// reserve claims a queue slot, waiting up to submitWait for one to free up
+func (s *scheduler) reserve(ctx context.Context) error {
+	timer := time.NewTimer(submitWait)
+	defer timer.Stop()
+
+	select {
+	case <-s.slots:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *scheduler) release() {
+	s.slots <- struct{}{}
+}
+
+// push queues a job whose slot has already been reserved
+func (s *scheduler) push(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lanes[job.Priority].push(job)
+	s.size++
+	s.cond.Broadcast()
+}
+
+// remove takes a job out of the queue, returning false if a worker already has it
+func (s *scheduler) remove(job *Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lanes[job.Priority].remove(job) {
+		return false
+	}
+	s.size--
+	s.release()
+	return true
+}
+
+// next blocks until there is a job whose user is under their concurrency cap
+func (s *scheduler) next() *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		job := pick(&s.lanes, &s.burst, s.eligible)
+		if job != nil {
+			s.running[job.UserID]++
+			s.size--
+			s.release()
+			return job
+		}
+		s.cond.Wait()
+	}
+}
+
+// done marks a job returned by next as no longer running
+func (s *scheduler) done(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running[job.UserID]--
+	if s.running[job.UserID] <= 0 {
+		delete(s.running, job.UserID)
+	}
+	s.cond.Broadcast()
+}
+
+func (s *scheduler) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// position estimates where a queued job is in line (1-based, 0 if not queued) by
+// replaying the scheduler on a copy of the queue, ignoring concurrency caps
+func (s *scheduler) position(job *Job) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lanes := [2]*lane{s.lanes[0].clone(), s.lanes[1].clone()}
+	burst := s.burst
+	always := func(uint) bool { return true }
+
+	for pos := 1; ; pos++ {
+		picked := pick(&lanes, &burst, always)
+		if picked == nil {
+			return 0
+		}
+		if picked == job {
+			return pos
+		}
+	}
+}
+
+func (s *scheduler) eligible(userID uint) bool {
+	return s.maxPerUser <= 0 || s.running[userID] < s.maxPerUser
+}
+
+// pick takes the next job to run. Interactive jobs go first, but every interactiveBurst
+// picks a waiting batch job is let through so exports still make progress.
+func pick(lanes *[2]*lane, burst *int, eligible func(uint) bool) *Job {
+	interactive, batch := lanes[PriorityInteractive], lanes[PriorityBatch]
+
+	if *burst < interactiveBurst {
+		if job := interactive.pop(eligible); job != nil {
+			if len(batch.users) > 0 {
+				*burst++
+			}
+			return job
+		}
+	}
+	if job := batch.pop(eligible); job != nil {
+		*burst = 0
+		return job
+	}
+	return interactive.pop(eligible)
+}
+
+func (l *lane) push(job *Job) {
+	if _, ok := l.pending[job.UserID]; !ok {
+		l.users = append(l.users, job.UserID)
+	}
+	l.pending[job.UserID] = append(l.pending[job.UserID], job)
+}
+
+// pop takes the oldest job of the next eligible user and moves that user to the back
+func (l *lane) pop(eligible func(uint) bool) *Job {
+	for i := 0; i < len(l.users); i++ {
+		idx := (l.next + i) % len(l.users)
+		userID := l.users[idx]
+		if !eligible(userID) {
+			continue
+		}
+
+		queue := l.pending[userID]
+		job := queue[0]
+		if len(queue) == 1 {
+			delete(l.pending, userID)
+			l.users = append(l.users[:idx], l.users[idx+1:]...)
+			l.next = idx
+		} else {
+			l.pending[userID] = queue[1:]
+			l.next = idx + 1
+		}
+		if len(l.users) > 0 {
+			l.next %= len(l.users)
+		} else {
+			l.next = 0
+		}
+		return job
+	}
+	return nil
+}
+
+func (l *lane) remove(job *Job) bool {
+	queue := l.pending[job.UserID]
+	for i, queued := range queue {
+		if queued != job {
+			continue
+		}
+		if len(queue) > 1 {
+			l.pending[job.UserID] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+		for idx, userID := range l.users {
+			if userID == job.UserID {
+				l.dropUser(idx)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// dropUser removes the user at idx, keeping next pointed at the same following user
+func (l *lane) dropUser(idx int) {
+	delete(l.pending, l.users[idx])
+	l.users = append(l.users[:idx], l.users[idx+1:]...)
+	if idx < l.next {
+		l.next--
+	} else if idx == l.next && l.next >= len(l.users) {
+		l.next = 0
+	}
+}
+
+func (l *lane) clone() *lane {
+	c := &lane{
+		users:   append([]uint{}, l.users...),
+		pending: make(map[uint][]*Job, len(l.pending)),
+		next:    l.next,
+	}
+	for userID, queue := range l.pending {
+		c.pending[userID] = append([]*Job{}, queue...)
+	}
+	return c
+}
@@ -0,0 +1,175 @@
+package cv_service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testJob(id string, userID uint, priority Priority) *Job {
+	return &Job{ID: id, UserID: userID, Priority: priority}
+}
+
+// enqueue reserves a slot for each job and queues it, like SubmitJob does
+func enqueue(t *testing.T, s *scheduler, jobs ...*Job) {
+	t.Helper()
+	for _, job := range jobs {
+		if err := s.reserve(context.Background()); err != nil {
+			t.Fatalf("reserve %s: %v", job.ID, err)
+		}
+		s.push(job)
+	}
+}
+
+// drain takes every job off the scheduler in the order workers would get them,
+// finishing each one right away
+func drain(s *scheduler) []string {
+	var order []string
+	for s.depth() > 0 {
+		job := s.next()
+		order = append(order, job.ID)
+		s.done(job)
+	}
+	return order
+}
+
+func assertOrder(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	s := newScheduler(10, 0)
+	enqueue(t, s,
+		testJob("a1", 1, PriorityBatch),
+		testJob("a2", 1, PriorityBatch),
+		testJob("a3", 1, PriorityBatch),
+		testJob("b1", 2, PriorityBatch),
+		testJob("c1", 3, PriorityBatch),
+		testJob("b2", 2, PriorityBatch),
+	)
+
+	assertOrder(t, drain(s), "a1", "b1", "c1", "a2", "b2", "a3")
+}
+
+func TestSchedulerInteractiveBurst(t *testing.T) {
+	s := newScheduler(10, 0)
+	enqueue(t, s,
+		testJob("b1", 1, PriorityBatch),
+		testJob("b2", 1, PriorityBatch),
+		testJob("i1", 2, PriorityInteractive),
+		testJob("i2", 2, PriorityInteractive),
+		testJob("i3", 2, PriorityInteractive),
+		testJob("i4", 2, PriorityInteractive),
+		testJob("i5", 2, PriorityInteractive),
+	)
+
+	// a batch job gets through after every interactiveBurst interactive jobs
+	assertOrder(t, drain(s), "i1", "i2", "i3", "b1", "i4", "i5", "b2")
+}
+
+func TestSchedulerInteractiveWithoutBatch(t *testing.T) {
+	s := newScheduler(10, 0)
+	enqueue(t, s,
+		testJob("i1", 1, PriorityInteractive),
+		testJob("i2", 1, PriorityInteractive),
+		testJob("i3", 1, PriorityInteractive),
+		testJob("i4", 1, PriorityInteractive),
+	)
+	assertOrder(t, drain(s), "i1", "i2", "i3", "i4")
+
+	// no batch job was waiting, so that run doesn't count as a burst
+	enqueue(t, s, testJob("b1", 1, PriorityBatch), testJob("i5", 1, PriorityInteractive))
+	assertOrder(t, drain(s), "i5", "b1")
+}
+
+func TestSchedulerPerUserCap(t *testing.T) {
+	s := newScheduler(10, 1)
+	enqueue(t, s,
+		testJob("a1", 1, PriorityBatch),
+		testJob("a2", 1, PriorityBatch),
+		testJob("b1", 2, PriorityBatch),
+	)
+
+	first := s.next()
+	second := s.next()
+	if first.ID != "a1" || second.ID != "b1" {
+		t.Fatalf("got %s, %s, want a1, b1", first.ID, second.ID)
+	}
+
+	// user 1 is at their cap until a1 is done
+	picked := make(chan *Job)
+	go func() { picked <- s.next() }()
+	select {
+	case job := <-picked:
+		t.Fatalf("got %s while user 1 was at their cap", job.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.done(first)
+	select {
+	case job := <-picked:
+		if job.ID != "a2" {
+			t.Fatalf("got %s, want a2", job.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a2 was never handed out")
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	s := newScheduler(10, 0)
+	a1, a2, b1 := testJob("a1", 1, PriorityBatch), testJob("a2", 1, PriorityBatch), testJob("b1", 2, PriorityBatch)
+	enqueue(t, s, a1, a2, b1)
+
+	if !s.remove(a1) {
+		t.Fatal("remove a1 returned false")
+	}
+	if s.remove(a1) {
+		t.Fatal("removing a1 twice returned true")
+	}
+	if s.depth() != 2 {
+		t.Fatalf("depth = %d, want 2", s.depth())
+	}
+	assertOrder(t, drain(s), "a2", "b1")
+	if len(s.slots) != cap(s.slots) {
+		t.Fatalf("%d of %d slots free after draining", len(s.slots), cap(s.slots))
+	}
+}
+
+func TestSchedulerPosition(t *testing.T) {
+	s := newScheduler(10, 0)
+	a1, a2, b1, i1 := testJob("a1", 1, PriorityBatch), testJob("a2", 1, PriorityBatch), testJob("b1", 2, PriorityBatch), testJob("i1", 3, PriorityInteractive)
+	enqueue(t, s, a1, a2, b1, i1)
+
+	want := map[*Job]int{i1: 1, a1: 2, b1: 3, a2: 4}
+	for job, pos := range want {
+		if got := s.position(job); got != pos {
+			t.Errorf("position(%s) = %d, want %d", job.ID, got, pos)
+		}
+	}
+	if got := s.position(testJob("x", 1, PriorityBatch)); got != 0 {
+		t.Errorf("position of an unqueued job = %d, want 0", got)
+	}
+	if s.depth() != 4 {
+		t.Errorf("position changed the queue, depth = %d", s.depth())
+	}
+}
+
+func TestSchedulerReserveFull(t *testing.T) {
+	s := newScheduler(1, 0)
+	enqueue(t, s, testJob("a1", 1, PriorityBatch))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.reserve(ctx); err != context.Canceled {
+		t.Fatalf("reserve on a full queue = %v, want context.Canceled", err)
+	}
+}
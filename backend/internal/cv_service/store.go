@@ -0,0 +1,348 @@
+package cv_service
+
+import (
+	"context"
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Jobs are persisted in the cv_jobs table. The in-memory scheduler still decides what
+// runs next on this instance, but a job only runs once a worker has claimed its row,
+// so several backend instances can share one database. Input and output directories
+// have to be on storage every instance can see for that to work, since a job may run on
+// one instance and have its result fetched through another. That is what CV_WORK_DIR is
+// for, without it the backend falls back to a directory only it can see.
+
+const (
+	heartbeatInterval = 15 * time.Second
+	// a running job whose heartbeat is older than this is assumed to have lost its worker
+	orphanAfter = time.Minute
+	// orphaned jobs are retried this many times in total before being failed
+	maxAttempts = 3
+	// queued jobs older than this that no instance is working on get adopted by the poller
+	adoptAfter   = 5 * time.Second
+	pollInterval = 2 * time.Second
+)
+
+// instanceID identifies this backend process in cv_jobs.worker_id
+var instanceID = generateJobID()
+
+func insertJobRecord(job *Job) error {
+	pipeline, err := json.Marshal(job.Pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pipeline: %v", err)
+	}
+	inputPaths, err := json.Marshal(job.InputPaths)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input paths: %v", err)
+	}
+	capture, err := json.Marshal(job.Capture)
+	if err != nil {
+		return fmt.Errorf("failed to marshal capture: %v", err)
+	}
+
+	record := models.CvJob{
+		ID:          job.ID,
+		UserID:      job.UserID,
+		Priority:    int(job.Priority),
+		State:       string(JobQueued),
+		Pipeline:    pipeline,
+		InputPaths:  inputPaths,
+		Capture:     capture,
+		SubmittedAt: job.submittedAt,
+	}
+	return initializers.DB.Create(&record).Error
+}
+
+// claimJobRecord moves a queued row to running for this worker. It returns false if the
+// row is no longer queued or another instance is claiming it right now.
+func claimJobRecord(jobID string, workerID string) (bool, error) {
+	claimed := false
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var record models.CvJob
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND state = ?", jobID, JobQueued).
+			Limit(1).
+			Find(&record)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		now := time.Now()
+		claimed = true
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"state":        JobRunning,
+			"worker_id":    workerID,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"started_at":   now,
+			"heartbeat_at": now,
+		}).Error
+	})
+
+	return claimed, err
+}
+
+// saveJobRecord writes a job's final state back to its row
+func saveJobRecord(job *Job) {
+	status := job.Status()
+
+	updates := map[string]interface{}{
+		"state":       status.State,
+		"finished_at": status.FinishedAt,
+		"error":       "",
+	}
+	if status.Error != nil {
+		updates["error"] = status.Error.Error()
+	}
+	if result := job.Result(); result != nil {
+		outputFiles, err := json.Marshal(result.OutputFiles)
+		if err == nil {
+			updates["output_files"] = outputFiles
+		}
+		if len(result.NodeOutputs) > 0 {
+			nodeOutputs, err := json.Marshal(result.NodeOutputs)
+			if err == nil {
+				updates["node_outputs"] = nodeOutputs
+			}
+		}
+	}
+
+	if err := initializers.DB.Model(&models.CvJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to save job %s: %v", job.ID, err)
+	}
+}
+
+func deleteJobRecord(jobID string) {
+	if err := initializers.DB.Where("id = ?", jobID).Delete(&models.CvJob{}).Error; err != nil {
+		log.Printf("Failed to delete job %s: %v", jobID, err)
+	}
+}
+
+func loadJobRecord(jobID string) (*models.CvJob, error) {
+	var record models.CvJob
+	if err := initializers.DB.Where("id = ?", jobID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// requestCancel cancels a job that is owned by some other instance. Queued rows are
+// cancelled outright, running rows are flagged for their worker's heartbeat to pick up.
+func requestCancel(jobID string) error {
+	db := initializers.DB.Model(&models.CvJob{})
+
+	if err := db.Where("id = ? AND state = ?", jobID, JobQueued).
+		Updates(map[string]interface{}{"state": JobCancelled, "finished_at": time.Now(), "error": "job cancelled"}).Error; err != nil {
+		return err
+	}
+	return db.Where("id = ? AND state = ?", jobID, JobRunning).
+		Update("cancel_requested", true).Error
+}
+
+// recoverOrphans requeues running jobs whose worker stopped heartbeating, or fails them
+// once they have used up maxAttempts
+func recoverOrphans() {
+	cutoff := time.Now().Add(-orphanAfter)
+	db := initializers.DB.Model(&models.CvJob{}).Where("state = ? AND heartbeat_at < ?", JobRunning, cutoff)
+
+	requeued := db.Session(&gorm.Session{}).Where("attempts < ?", maxAttempts).
+		Updates(map[string]interface{}{"state": JobQueued, "worker_id": ""})
+	if requeued.Error != nil {
+		log.Printf("Failed to requeue orphaned jobs: %v", requeued.Error)
+	}
+
+	failed := db.Session(&gorm.Session{}).Where("attempts >= ?", maxAttempts).
+		Updates(map[string]interface{}{
+			"state":       JobFailed,
+			"finished_at": time.Now(),
+			"error":       fmt.Sprintf("worker lost %d times, giving up", maxAttempts),
+		})
+	if failed.Error != nil {
+		log.Printf("Failed to fail orphaned jobs: %v", failed.Error)
+	}
+
+	if requeued.RowsAffected > 0 || failed.RowsAffected > 0 {
+		log.Printf("Recovered orphaned jobs: %d requeued, %d failed", requeued.RowsAffected, failed.RowsAffected)
+	}
+}
+
+// heartbeat keeps this instance's running jobs from being treated as orphans and
+// passes on cancellations requested through another instance
+func heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		jobsMu.Lock()
+		all := make([]*Job, 0, len(jobs))
+		for _, job := range jobs {
+			all = append(all, job)
+		}
+		jobsMu.Unlock()
+
+		running := map[string]*Job{}
+		var ids []string
+		for _, job := range all {
+			if !job.isRemote() && job.Status().State == JobRunning {
+				running[job.ID] = job
+				ids = append(ids, job.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		err := initializers.DB.Model(&models.CvJob{}).
+			Where("id IN ? AND state = ?", ids, JobRunning).
+			Update("heartbeat_at", time.Now()).Error
+		if err != nil {
+			log.Printf("Failed to heartbeat running jobs: %v", err)
+			continue
+		}
+
+		var cancelled []string
+		err = initializers.DB.Model(&models.CvJob{}).
+			Where("id IN ? AND cancel_requested", ids).
+			Pluck("id", &cancelled).Error
+		if err != nil {
+			log.Printf("Failed to check for cancelled jobs: %v", err)
+			continue
+		}
+		for _, id := range cancelled {
+			running[id].cancel()
+		}
+	}
+}
+
+// poll adopts queued jobs nobody is working on: resumed orphans, and jobs submitted to
+// an instance that has since gone away
+func poll() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var records []models.CvJob
+		err := initializers.DB.
+			Where("state = ? AND submitted_at < ?", JobQueued, time.Now().Add(-adoptAfter)).
+			Order("submitted_at").
+			Limit(cap(sched.slots)).
+			Find(&records).Error
+		if err != nil {
+			log.Printf("Failed to poll for queued jobs: %v", err)
+			continue
+		}
+
+		for i := range records {
+			// a remote mirror doesn't count, the instance it mirrors may be the one that died
+			if job, ok := localJob(records[i].ID); ok && !job.isRemote() {
+				continue
+			}
+			if !adoptJob(&records[i]) {
+				break
+			}
+		}
+	}
+}
+
+// adoptJob queues a job from its row on this instance. It returns false when there is
+// no room left in the local queue. A mirror of the job is replaced, it keeps watching the
+// row so whoever waits on it still sees the job finish.
+func adoptJob(record *models.CvJob) bool {
+	select {
+	case <-sched.slots:
+	default:
+		return false
+	}
+
+	job, err := jobFromRecord(record)
+	if err == nil {
+		for _, path := range job.InputPaths {
+			if _, statErr := os.Stat(path); statErr != nil {
+				err = fmt.Errorf("input files are missing: %v", statErr)
+				break
+			}
+		}
+	}
+	if err != nil {
+		sched.release()
+		log.Printf("Failed to adopt job %s: %v", record.ID, err)
+		initializers.DB.Model(&models.CvJob{}).Where("id = ? AND state = ?", record.ID, JobQueued).
+			Updates(map[string]interface{}{"state": JobFailed, "finished_at": time.Now(), "error": err.Error()})
+		return true
+	}
+
+	jobCtx, cancel := context.WithCancel(context.Background())
+	job.ctx = jobCtx
+	job.cancel = cancel
+	job.remote = false
+
+	jobsMu.Lock()
+	jobs[job.ID] = job
+	jobsMu.Unlock()
+
+	sched.push(job)
+	context.AfterFunc(jobCtx, job.cancelQueued)
+
+	log.Printf("Adopted queued job %s", job.ID)
+	return true
+}
+
+// jobFromRecord builds a remote Job mirroring a row
+func jobFromRecord(record *models.CvJob) (*Job, error) {
+	job := &Job{
+		ID:       record.ID,
+		UserID:   record.UserID,
+		Priority: Priority(record.Priority),
+		remote:   true,
+		done:     make(chan struct{}),
+	}
+	if err := json.Unmarshal(record.Pipeline, &job.Pipeline); err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %v", err)
+	}
+	if err := json.Unmarshal(record.InputPaths, &job.InputPaths); err != nil {
+		return nil, fmt.Errorf("invalid input paths: %v", err)
+	}
+	if len(record.Capture) > 0 {
+		if err := json.Unmarshal(record.Capture, &job.Capture); err != nil {
+			return nil, fmt.Errorf("invalid capture: %v", err)
+		}
+	}
+	job.applyRecord(record)
+	return job, nil
+}
+
+// watchRecord mirrors a job that another instance claimed until it finishes
+func watchRecord(job *Job) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		record, err := loadJobRecord(job.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			job.applyRecord(&models.CvJob{
+				ID:    job.ID,
+				State: string(JobFailed),
+				Error: "job record disappeared",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to refresh job %s: %v", job.ID, err)
+			continue
+		}
+		if job.applyRecord(record) {
+			return
+		}
+	}
+}
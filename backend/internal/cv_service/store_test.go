@@ -0,0 +1,103 @@
+package cv_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// orphanRecord stores a job that some other instance claimed and then stopped
+// heartbeating for
+func orphanRecord(t *testing.T, image string) *models.CvJob {
+	t.Helper()
+	id := generateJobID()
+	inputDir := filepath.Join(workDir, "input", id)
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inputPath := filepath.Join(inputDir, "image.png")
+	if err := os.WriteFile(inputPath, []byte(image), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline, _ := json.Marshal(models.PipelineData{})
+	inputPaths, _ := json.Marshal([]string{inputPath})
+	capture, _ := json.Marshal(Capture{})
+	lost := time.Now().Add(-2 * orphanAfter)
+	record := &models.CvJob{
+		ID:          id,
+		UserID:      1,
+		Priority:    int(PriorityInteractive),
+		State:       string(JobRunning),
+		Pipeline:    pipeline,
+		InputPaths:  inputPaths,
+		Capture:     capture,
+		Attempts:    1,
+		WorkerID:    "gone/0",
+		HeartbeatAt: &lost,
+		SubmittedAt: lost,
+		StartedAt:   &lost,
+	}
+	if err := initializers.DB.Create(record).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	t.Cleanup(func() { RemoveJob(id) })
+	return record
+}
+
+func TestOrphanIsRequeuedAndAdopted(t *testing.T) {
+	testExecutor.set(copyInputs)
+	record := orphanRecord(t, "orphan")
+
+	recoverOrphans()
+	requeued, err := loadJobRecord(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued.State != string(JobQueued) || requeued.WorkerID != "" {
+		t.Fatalf("orphan is %s on %q, want queued on no worker", requeued.State, requeued.WorkerID)
+	}
+
+	assertRecord(t, record.ID, JobSucceeded, "")
+	adopted, err := loadJobRecord(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(adopted.WorkerID, instanceID+"/") || adopted.Attempts != 2 {
+		t.Fatalf("orphan ran on %q after %d attempts, want this instance on attempt 2", adopted.WorkerID, adopted.Attempts)
+	}
+}
+
+func TestOrphanIsAdoptedOverItsMirror(t *testing.T) {
+	testExecutor.set(copyInputs)
+	record := orphanRecord(t, "mirrored")
+
+	// this instance was watching the job while the lost instance ran it
+	mirror, err := jobFromRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobsMu.Lock()
+	jobs[mirror.ID] = mirror
+	jobsMu.Unlock()
+	go watchRecord(mirror)
+
+	recoverOrphans()
+
+	if status := waitDone(t, mirror); status.State != JobSucceeded {
+		t.Fatalf("mirror finished %s (%v), want succeeded", status.State, status.Error)
+	}
+	job, ok := localJob(record.ID)
+	if !ok || job == mirror || job.isRemote() {
+		t.Fatal("the orphan was not adopted as a local job")
+	}
+	output, err := os.ReadFile(mirror.Result().OutputFiles[0])
+	if err != nil || string(output) != "mirrored" {
+		t.Fatalf("output = %q, %v", output, err)
+	}
+}
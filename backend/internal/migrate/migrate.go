@@ -13,6 +13,17 @@ func init() {
 func main() {
 	initializers.DB.AutoMigrate(
 		&models.User{},
+		&models.Tag{},
 		&models.Project{},
+		&models.ProjectVersion{},
+		&models.ProjectMember{},
+		&models.ProjectSample{},
+		&models.ShareLink{},
+		&models.Folder{},
+		&models.FolderProject{},
+		&models.CvJob{},
 	)
+
+	// backs the title search on the projects page
+	initializers.DB.Exec("CREATE INDEX IF NOT EXISTS idx_projects_title_search ON projects USING GIN (to_tsvector('simple', title))")
 }
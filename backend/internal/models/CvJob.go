@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// DATABASE SCHEMA
+// CvJob is the durable record of a cv_service job, so queued and running jobs survive
+// restarts and can be claimed by any backend instance
+type CvJob struct {
+	ID              string         `json:"id" gorm:"primary_key;type:uuid"`
+	UserID          uint           `json:"userId" gorm:"index"`
+	Priority        int            `json:"priority"`
+	State           string         `json:"state" gorm:"index"`
+	Pipeline        datatypes.JSON `json:"pipeline" gorm:"type:json"`
+	InputPaths      datatypes.JSON `json:"inputPaths" gorm:"type:json"`
+	OutputFiles     datatypes.JSON `json:"outputFiles" gorm:"type:json"`
+	Capture         datatypes.JSON `json:"capture" gorm:"type:json"`
+	NodeOutputs     datatypes.JSON `json:"nodeOutputs" gorm:"type:json"`
+	Error           string         `json:"error"`
+	Attempts        int            `json:"attempts"`
+	WorkerID        string         `json:"workerId"`
+	CancelRequested bool           `json:"cancelRequested"`
+	HeartbeatAt     *time.Time     `json:"heartbeatAt"`
+	SubmittedAt     time.Time      `json:"submittedAt" gorm:"index"`
+	StartedAt       *time.Time     `json:"startedAt"`
+	FinishedAt      *time.Time     `json:"finishedAt"`
+}
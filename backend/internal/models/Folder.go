@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// DATABASE SCHEMA
+// Folder is one of a user's own folders for organizing their project list
+type Folder struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	UserID    uint   `json:"userId" gorm:"uniqueIndex:idx_folder_name"`
+	Name      string `json:"name" gorm:"uniqueIndex:idx_folder_name"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FolderProject files a project into one of a user's folders. Folders are personal, so
+// each member of a shared project files it their own way, and a project is in at most
+// one folder per user.
+type FolderProject struct {
+	ID        uint `json:"id" gorm:"primary_key"`
+	UserID    uint `json:"userId" gorm:"uniqueIndex:idx_folder_project"`
+	ProjectID uint `json:"projectId" gorm:"uniqueIndex:idx_folder_project;index"`
+	FolderID  uint `json:"folderId" gorm:"index"`
+	CreatedAt time.Time
+}
+
+// SLICES
+type FolderInput struct {
+	Name string `json:"name"`
+}
+type FolderInfo struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	ProjectCount int    `json:"projectCount"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+// ProjectFolderInput moves a project, a null folderId takes it out of its folder
+type ProjectFolderInput struct {
+	FolderID *uint `json:"folderId"`
+}
@@ -0,0 +1,437 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CvNodeType is the stable key of a node type, shared with the frontend and cv.cpp. Keys
+// are never renamed or reused, so new types can be added anywhere without touching
+// saved projects.
+type CvNodeType string
+
+const (
+	CvNodeSource  CvNodeType = "source"
+	CvNodeOutput  CvNodeType = "output"
+	CvNodeBlur    CvNodeType = "blur"
+	CvNodeDeepFry CvNodeType = "deepfry"
+)
+
+// LegacyCvNodeTypes maps the integer enum values node types were stored as before they
+// had keys. It must never change.
+var LegacyCvNodeTypes = []CvNodeType{CvNodeSource, CvNodeOutput, CvNodeBlur, CvNodeDeepFry}
+
+// CvNodeTypeFromLegacy translates an old integer node type, or returns false if there was
+// no such type
+func CvNodeTypeFromLegacy(value int) (CvNodeType, bool) {
+	if value < 0 || value >= len(LegacyCvNodeTypes) {
+		return "", false
+	}
+	return LegacyCvNodeTypes[value], true
+}
+
+func (t CvNodeType) String() string {
+	return string(t)
+}
+
+// UnmarshalJSON takes a key, or a legacy integer from an editor that predates keys.
+// Unknown integers become an unknown key so validation can report them.
+func (t *CvNodeType) UnmarshalJSON(b []byte) error {
+	var key string
+	if err := json.Unmarshal(b, &key); err == nil {
+		*t = CvNodeType(key)
+		return nil
+	}
+	var legacy int
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		return fmt.Errorf("node type must be a string key: %s", b)
+	}
+	if nodeType, ok := CvNodeTypeFromLegacy(legacy); ok {
+		*t = nodeType
+	} else {
+		*t = CvNodeType(strconv.Itoa(legacy))
+	}
+	return nil
+}
+
+// PIPELINE GRAPH
+// The pipeline, its nodes and edges are stored exactly as React Flow hands them to us.
+// The fields the backend cares about are typed, everything else (viewport, measured,
+// selected, style, ...) is kept in Extra so that a load -> save round trip never drops
+// data. Typed fields that were missing on the way in stay missing on the way out unless
+// they were set since.
+
+type PipelineData struct {
+	Nodes         []PipelineNode
+	Edges         []PipelineEdge
+	SchemaVersion int // see pipeline_service.CurrentSchemaVersion
+	Extra         map[string]json.RawMessage
+}
+
+type PipelineNode struct {
+	ID       string
+	Type     string
+	Position *NodePosition
+	Data     PipelineNodeData
+	Extra    map[string]json.RawMessage
+
+	present fieldSet
+}
+
+type NodePosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type PipelineNodeData struct {
+	Name       string
+	CvNodeType CvNodeType // empty when the node has no type
+	Params     map[string]ParamValue
+	Extra      map[string]json.RawMessage
+
+	present fieldSet
+}
+
+// fieldSet records which optional typed fields were in the JSON a node was decoded from
+type fieldSet uint8
+
+const (
+	nodeHasType fieldSet = 1 << iota
+	nodeHasData
+)
+
+const (
+	dataHasName fieldSet = 1 << iota
+	dataHasCvNodeType
+	dataHasParams
+)
+
+func (d *PipelineNodeData) isEmpty() bool {
+	return d.present == 0 && d.Name == "" && d.CvNodeType == "" && len(d.Params) == 0 && len(d.Extra) == 0
+}
+
+type PipelineEdge struct {
+	ID           string
+	Source       string
+	Target       string
+	SourceHandle *string
+	TargetHandle *string
+	Extra        map[string]json.RawMessage
+}
+
+// NodeByID returns the node with the given id, or nil if there is none
+func (p *PipelineData) NodeByID(id string) *PipelineNode {
+	for i := range p.Nodes {
+		if p.Nodes[i].ID == id {
+			return &p.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// ====================================================================================================
+// PARAMS
+
+// ParamValue is a single node param, kept as raw JSON so ints stay ints and
+// unknown param shapes survive untouched
+type ParamValue json.RawMessage
+
+func NewParamValue(v interface{}) (ParamValue, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ParamValue(b), nil
+}
+
+func (v ParamValue) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	return v, nil
+}
+
+func (v *ParamValue) UnmarshalJSON(b []byte) error {
+	*v = append((*v)[0:0], b...)
+	return nil
+}
+
+func (v ParamValue) Float() (float64, bool) {
+	var f float64
+	if err := json.Unmarshal(v, &f); err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+func (v ParamValue) Int() (int, bool) {
+	f, ok := v.Float()
+	if !ok || f != float64(int(f)) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+func (v ParamValue) Bool() (bool, bool) {
+	var b bool
+	if err := json.Unmarshal(v, &b); err != nil {
+		return false, false
+	}
+	return b, true
+}
+
+func (v ParamValue) Text() (string, bool) {
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// ====================================================================================================
+// JSON
+
+func (p PipelineData) MarshalJSON() ([]byte, error) {
+	m := copyExtra(p.Extra)
+	if err := setField(m, "nodes", p.Nodes); err != nil {
+		return nil, err
+	}
+	if err := setField(m, "edges", p.Edges); err != nil {
+		return nil, err
+	}
+	if err := setField(m, "schemaVersion", p.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (p *PipelineData) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*p = PipelineData{}
+	if err := takeField(m, "nodes", &p.Nodes); err != nil {
+		return err
+	}
+	if err := takeField(m, "edges", &p.Edges); err != nil {
+		return err
+	}
+	if err := takeField(m, "schemaVersion", &p.SchemaVersion); err != nil {
+		return err
+	}
+	// nulls were left for writing back as-is, but these three are always written
+	delete(m, "nodes")
+	delete(m, "edges")
+	delete(m, "schemaVersion")
+	p.Extra = extraOrNil(m)
+	return nil
+}
+
+func (n PipelineNode) MarshalJSON() ([]byte, error) {
+	m := copyExtra(n.Extra)
+	if err := setField(m, "id", n.ID); err != nil {
+		return nil, err
+	}
+	if n.Type != "" || n.present&nodeHasType != 0 {
+		if err := setField(m, "type", n.Type); err != nil {
+			return nil, err
+		}
+	}
+	if n.Position != nil {
+		if err := setField(m, "position", n.Position); err != nil {
+			return nil, err
+		}
+	}
+	if !n.Data.isEmpty() || n.present&nodeHasData != 0 {
+		if err := setField(m, "data", n.Data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (n *PipelineNode) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*n = PipelineNode{}
+	if err := takeField(m, "id", &n.ID); err != nil {
+		return err
+	}
+	if err := takePresentField(m, "type", &n.Type, &n.present, nodeHasType); err != nil {
+		return err
+	}
+	if err := takeField(m, "position", &n.Position); err != nil {
+		return err
+	}
+	if err := takePresentField(m, "data", &n.Data, &n.present, nodeHasData); err != nil {
+		return err
+	}
+	n.Extra = extraOrNil(m)
+	return nil
+}
+
+func (d PipelineNodeData) MarshalJSON() ([]byte, error) {
+	m := copyExtra(d.Extra)
+	if d.Name != "" || d.present&dataHasName != 0 {
+		if err := setField(m, "name", d.Name); err != nil {
+			return nil, err
+		}
+	}
+	if d.CvNodeType != "" || d.present&dataHasCvNodeType != 0 {
+		if err := setField(m, "cvNodeType", d.CvNodeType); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.Params) > 0 || d.present&dataHasParams != 0 {
+		params := d.Params
+		if params == nil {
+			params = map[string]ParamValue{}
+		}
+		if err := setField(m, "params", params); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (d *PipelineNodeData) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*d = PipelineNodeData{}
+	if err := takePresentField(m, "name", &d.Name, &d.present, dataHasName); err != nil {
+		return err
+	}
+	if err := takePresentField(m, "cvNodeType", &d.CvNodeType, &d.present, dataHasCvNodeType); err != nil {
+		return err
+	}
+	if err := takePresentField(m, "params", &d.Params, &d.present, dataHasParams); err != nil {
+		return err
+	}
+	d.Extra = extraOrNil(m)
+	return nil
+}
+
+func (e PipelineEdge) MarshalJSON() ([]byte, error) {
+	m := copyExtra(e.Extra)
+	if e.ID != "" {
+		if err := setField(m, "id", e.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := setField(m, "source", e.Source); err != nil {
+		return nil, err
+	}
+	if err := setField(m, "target", e.Target); err != nil {
+		return nil, err
+	}
+	if e.SourceHandle != nil {
+		if err := setField(m, "sourceHandle", e.SourceHandle); err != nil {
+			return nil, err
+		}
+	}
+	if e.TargetHandle != nil {
+		if err := setField(m, "targetHandle", e.TargetHandle); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (e *PipelineEdge) UnmarshalJSON(b []byte) error {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	*e = PipelineEdge{}
+	if err := takeField(m, "id", &e.ID); err != nil {
+		return err
+	}
+	if err := takeField(m, "source", &e.Source); err != nil {
+		return err
+	}
+	if err := takeField(m, "target", &e.Target); err != nil {
+		return err
+	}
+	if err := takeField(m, "sourceHandle", &e.SourceHandle); err != nil {
+		return err
+	}
+	if err := takeField(m, "targetHandle", &e.TargetHandle); err != nil {
+		return err
+	}
+	e.Extra = extraOrNil(m)
+	return nil
+}
+
+// takeField decodes m[key] into dst and removes it from m. A missing key leaves dst
+// at its zero value, and an explicit null is left in m so it is written back as-is.
+func takeField(m map[string]json.RawMessage, key string, dst interface{}) error {
+	raw, ok := m[key]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+	delete(m, key)
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("invalid %q: %v", key, err)
+	}
+	return nil
+}
+
+// takePresentField is takeField for optional fields, recording in present whether the
+// field was there so it can be written back even when it holds its zero value
+func takePresentField(m map[string]json.RawMessage, key string, dst interface{}, present *fieldSet, flag fieldSet) error {
+	if raw, ok := m[key]; ok && string(raw) != "null" {
+		*present |= flag
+	}
+	return takeField(m, key, dst)
+}
+
+func setField(m map[string]json.RawMessage, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m[key] = b
+	return nil
+}
+
+func copyExtra(extra map[string]json.RawMessage) map[string]json.RawMessage {
+	m := make(map[string]json.RawMessage, len(extra)+4)
+	for k, v := range extra {
+		m[k] = v
+	}
+	return m
+}
+
+func extraOrNil(m map[string]json.RawMessage) map[string]json.RawMessage {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// ====================================================================================================
+// SLICES
+
+// PipelineDiffInput picks the two pipelines POST /api/pipeline/diff compares
+type PipelineDiffInput struct {
+	Base   PipelineSource `json:"base"`
+	Target PipelineSource `json:"target"`
+}
+
+// PipelineSource is either a pipeline sent inline as Data, or a stored project. With
+// Version set the project's saved version is used instead of its current state.
+type PipelineSource struct {
+	Data      *PipelineData `json:"data"`
+	ProjectID uint          `json:"projectId"`
+	Version   int           `json:"version"`
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPipelineDataRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "unknown fields",
+			in: `{"schemaVersion":2,
+				"nodes":[{"id":"a","type":"chiveNode","position":{"x":1.5,"y":-2},"measured":{"width":160,"height":90},"selected":true,
+					"data":{"name":"Blur","cvNodeType":"blur","params":{"size":5,"extra":{"nested":[1,2]}},"color":"#fff"}}],
+				"edges":[{"id":"e","source":"a","target":"b","sourceHandle":"out-0","animated":true}]}`,
+		},
+		{
+			name: "unknown top-level fields",
+			in: `{"schemaVersion":2,"viewport":{"x":-120.5,"y":40,"zoom":0.75},"snapToGrid":true,
+				"nodes":[{"id":"a","data":{"cvNodeType":"source"}}],"edges":[]}`,
+		},
+		{
+			name: "null nodes and edges",
+			in:   `{"schemaVersion":2,"nodes":null,"edges":null,"viewport":null}`,
+		},
+		{
+			name: "missing data fields",
+			in:   `{"schemaVersion":2,"nodes":[{"id":"a","data":{"name":"only a name"}},{"id":"b","data":{}}],"edges":[]}`,
+		},
+		{
+			name: "zero values that were present",
+			in:   `{"schemaVersion":2,"nodes":[{"id":"a","type":"","data":{"name":"","cvNodeType":"","params":{}}}],"edges":[]}`,
+		},
+		{
+			name: "missing data",
+			in:   `{"schemaVersion":2,"nodes":[{"id":"a"}],"edges":[]}`,
+		},
+		{
+			name: "explicit nulls",
+			in:   `{"schemaVersion":2,"nodes":[{"id":"a","type":null,"position":null,"data":null},{"id":"b","data":{"name":null,"params":null}}],"edges":[{"source":"a","target":"b","targetHandle":null}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pipeline PipelineData
+			if err := json.Unmarshal([]byte(test.in), &pipeline); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			out, err := json.Marshal(pipeline)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			assertSameJSON(t, test.in, string(out))
+		})
+	}
+}
+
+func TestPipelineNodeDataMissingType(t *testing.T) {
+	var data PipelineNodeData
+	if err := json.Unmarshal([]byte(`{"name":"n"}`), &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if data.CvNodeType != "" {
+		t.Errorf("CvNodeType = %q, want empty", data.CvNodeType)
+	}
+}
+
+func TestPipelineNodeDataSetFields(t *testing.T) {
+	var data PipelineNodeData
+	if err := json.Unmarshal([]byte(`{}`), &data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	data.Name = "renamed"
+	data.Params = map[string]ParamValue{"size": ParamValue("3")}
+
+	out, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	assertSameJSON(t, `{"name":"renamed","params":{"size":3}}`, string(out))
+}
+
+func TestPipelineDataKeepsViewport(t *testing.T) {
+	var pipeline PipelineData
+	in := `{"schemaVersion":1,"viewport":{"x":10,"y":20,"zoom":1.5},"nodes":[{"id":"a"}],"edges":[]}`
+	if err := json.Unmarshal([]byte(in), &pipeline); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(pipeline.Extra) != 1 || string(pipeline.Extra["viewport"]) != `{"x":10,"y":20,"zoom":1.5}` {
+		t.Fatalf("Extra = %v, want only the viewport", pipeline.Extra)
+	}
+
+	// typed fields win over anything in Extra with the same name
+	pipeline.SchemaVersion = 2
+	pipeline.Nodes = append(pipeline.Nodes, PipelineNode{ID: "b"})
+	pipeline.Extra["nodes"] = json.RawMessage(`[]`)
+	out, err := json.Marshal(pipeline)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	assertSameJSON(t, `{"schemaVersion":2,"viewport":{"x":10,"y":20,"zoom":1.5},"nodes":[{"id":"a"},{"id":"b"}],"edges":[]}`, string(out))
+}
+
+func TestCvNodeTypeUnmarshal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want CvNodeType
+	}{
+		{`"blur"`, CvNodeBlur},
+		{`"somethingNew"`, CvNodeType("somethingNew")},
+		{`0`, CvNodeSource},
+		{`1`, CvNodeOutput},
+		{`2`, CvNodeBlur},
+		{`3`, CvNodeDeepFry},
+		{`9`, CvNodeType("9")},
+	}
+
+	for _, test := range tests {
+		var nodeType CvNodeType
+		if err := json.Unmarshal([]byte(test.in), &nodeType); err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if nodeType != test.want {
+			t.Errorf("%s: got %q, want %q", test.in, nodeType, test.want)
+		}
+	}
+
+	var nodeType CvNodeType
+	if err := json.Unmarshal([]byte(`true`), &nodeType); err == nil {
+		t.Errorf("true: expected an error")
+	}
+}
+
+func assertSameJSON(t *testing.T, want string, got string) {
+	t.Helper()
+	var wantValue, gotValue interface{}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("bad expected JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("bad output JSON: %v", err)
+	}
+	if !reflect.DeepEqual(wantValue, gotValue) {
+		t.Errorf("JSON differs\nwant: %s\n got: %s", want, got)
+	}
+}
@@ -4,37 +4,97 @@ import (
 	"time"
 
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
-type PipelineData struct {
-	Nodes []interface{} `json:"nodes"`
-	Edges []interface{} `json:"edges"`
-}
-
 // DATABASE SCHEMA
 type Project struct {
 	ID              uint           `json:"id" gorm:"primary_key"`
 	CreatorID       uint           `json:"creatorId"`
 	CreatorUsername string         `json:"creatorUsername"`
 	Title           string         `json:"title"`
+	Description     string         `json:"description"`
 	Data            datatypes.JSON `json:"data" gorm:"type:json"`
+	Tags            []Tag          `json:"tags" gorm:"many2many:project_tags"`
+	Published       bool           `json:"published" gorm:"index;not null;default:false"` // listed in the template gallery
+	PublishedAt     *time.Time     `json:"publishedAt"`
+	UseCount        int            `json:"useCount" gorm:"not null;default:0"`      // projects created from this template
+	TemplateID      *uint          `json:"templateId"`                              // the template this project was created from
+	ParentID        *uint          `json:"parentId" gorm:"index"`                   // the project this one was forked from
+	ParentVersion   int            `json:"parentVersion" gorm:"not null;default:0"` // the parent's version it was forked from or last pulled
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"` // set while the project is in the trash
 }
 
 // SLICES
 type ProjectInput struct {
-	ID        uint         `json:"id"`
-	Title     string       `json:"title"`
-	Data      PipelineData `json:"data"`
-	CreatedAt string       `json:"createdAt"`
-	UpdatedAt string       `json:"updatedAt"`
+	ID            uint         `json:"id"`
+	Title         string       `json:"title"`
+	Data          PipelineData `json:"data"`
+	Message       string       `json:"message"`  // optional, names the version this save creates
+	Autosave      bool         `json:"autosave"` // saves made by the editor on its own, pruned over time
+	CreatedAt     string       `json:"createdAt"`
+	UpdatedAt     string       `json:"updatedAt"`
+	BaseVersion   int          `json:"baseVersion"`   // the version the editor loaded, older bases are rejected
+	BaseUpdatedAt string       `json:"baseUpdatedAt"` // fallback for clients that only track updatedAt
 }
 type ProjectInfo struct {
-	ID              uint   `json:"id"`
-	CreatorID       uint   `json:"creatorId"`
-	CreatorUsername string `json:"creatorUsername"`
-	Title           string `json:"title"`
-	CreatedAt       string `json:"createdAt"`
-	UpdatedAt       string `json:"updatedAt"`
+	ID              uint        `json:"id"`
+	CreatorID       uint        `json:"creatorId"`
+	CreatorUsername string      `json:"creatorUsername"`
+	Title           string      `json:"title"`
+	Description     string      `json:"description"`
+	Tags            []string    `json:"tags"`
+	Published       bool        `json:"published"`
+	TemplateID      *uint       `json:"templateId"`
+	ParentID        *uint       `json:"parentId"`
+	ParentVersion   int         `json:"parentVersion"`
+	FolderID        *uint       `json:"folderId"` // the current user's folder for the project
+	Role            ProjectRole `json:"role"`     // the current user's role on the project
+	CreatedAt       string      `json:"createdAt"`
+	UpdatedAt       string      `json:"updatedAt"`
+}
+type TemplateInfo struct {
+	ID              uint     `json:"id"`
+	CreatorUsername string   `json:"creatorUsername"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	Tags            []string `json:"tags"`
+	UseCount        int      `json:"useCount"`
+	PublishedAt     string   `json:"publishedAt"`
+}
+type TemplateUseInput struct {
+	Title string `json:"title"`
+}
+
+type TrashedProjectInfo struct {
+	ProjectInfo
+	DeletedAt string `json:"deletedAt"`
+	PurgeAt   string `json:"purgeAt"` // when the project is deleted for good
+}
+
+// ProjectPatch holds the fields PATCH /api/project/:id can change, nil fields are left alone
+type ProjectPatch struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"` // replaces the project's tags
+}
+type ProjectDuplicateInput struct {
+	Title string `json:"title"`
+}
+type ProjectPullInput struct {
+	Message     string `json:"message"`
+	BaseVersion int    `json:"baseVersion"` // the fork's version the editor has loaded, like a save
+}
+
+// ForkNode is one project in a fork tree. Projects the user can't open only show where
+// they sit in the tree, not what they are called or who made them.
+type ForkNode struct {
+	ID              uint       `json:"id"`
+	Title           string     `json:"title,omitempty"`
+	CreatorUsername string     `json:"creatorUsername,omitempty"`
+	ParentVersion   int        `json:"parentVersion"`
+	Accessible      bool       `json:"accessible"`
+	Forks           []ForkNode `json:"forks"`
 }
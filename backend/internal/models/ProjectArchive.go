@@ -0,0 +1,27 @@
+package models
+
+// SLICES
+// A .chive archive is a zip holding manifest.json, described by ProjectArchiveManifest,
+// and the project's sample images under samples/.
+
+type ProjectArchiveManifest struct {
+	Format        string                 `json:"format"` // always "chive-project"
+	SchemaVersion int                    `json:"schemaVersion"`
+	ExportedAt    string                 `json:"exportedAt"`
+	ExportedBy    string                 `json:"exportedBy"`
+	Project       ProjectArchiveMetadata `json:"project"`
+	Data          PipelineData           `json:"data"`
+	Samples       []ProjectArchiveSample `json:"samples"`
+}
+type ProjectArchiveMetadata struct {
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	Tags            []string `json:"tags"`
+	CreatorUsername string   `json:"creatorUsername"`
+	CreatedAt       string   `json:"createdAt"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+type ProjectArchiveSample struct {
+	Name        string `json:"name"` // the file is samples/<name>
+	ContentType string `json:"contentType"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+)
+
+// ProjectRole is what a user may do with a project. Each role includes everything the
+// roles below it allow.
+type ProjectRole string
+
+const (
+	RoleViewer ProjectRole = "viewer" // open, run and duplicate the pipeline
+	RoleEditor ProjectRole = "editor" // save changes and restore versions
+	RoleOwner  ProjectRole = "owner"  // delete the project and manage its members
+)
+
+func (r ProjectRole) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (r ProjectRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether r grants at least the required role
+func (r ProjectRole) Allows(required ProjectRole) bool {
+	return r.Valid() && r.rank() >= required.rank()
+}
+
+// DATABASE SCHEMA
+// ProjectMember gives a user other than the creator access to a project. The creator is
+// always an owner and has no row of their own.
+type ProjectMember struct {
+	ID        uint        `json:"id" gorm:"primary_key"`
+	ProjectID uint        `json:"projectId" gorm:"uniqueIndex:idx_project_member"`
+	UserID    uint        `json:"userId" gorm:"uniqueIndex:idx_project_member;index"`
+	Role      ProjectRole `json:"role"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SLICES
+type ProjectMemberInput struct {
+	Username string      `json:"username"`
+	Role     ProjectRole `json:"role"`
+}
+type ProjectMemberRoleInput struct {
+	Role ProjectRole `json:"role"`
+}
+type ProjectMemberInfo struct {
+	UserID   uint        `json:"userId"`
+	Username string      `json:"username"`
+	Role     ProjectRole `json:"role"`
+	Creator  bool        `json:"creator"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestProjectRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     ProjectRole
+		required ProjectRole
+		want     bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleEditor, true},
+		{RoleOwner, RoleViewer, true},
+		{RoleEditor, RoleOwner, false},
+		{RoleEditor, RoleEditor, true},
+		{RoleEditor, RoleViewer, true},
+		{RoleViewer, RoleOwner, false},
+		{RoleViewer, RoleEditor, false},
+		{RoleViewer, RoleViewer, true},
+		// no role, or one that doesn't exist, allows nothing
+		{"", RoleViewer, false},
+		{"admin", RoleViewer, false},
+		{"", "", false},
+		{"Owner", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestProjectRoleValid(t *testing.T) {
+	for _, role := range []ProjectRole{RoleViewer, RoleEditor, RoleOwner} {
+		if !role.Valid() {
+			t.Errorf("%q is not valid", role)
+		}
+	}
+	for _, role := range []ProjectRole{"", "admin", "OWNER"} {
+		if role.Valid() {
+			t.Errorf("%q is valid", role)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// DATABASE SCHEMA
+// ProjectSample is an example image kept with a project, for trying the pipeline on and
+// for carrying along in exported archives
+type ProjectSample struct {
+	ID          uint   `json:"id" gorm:"primary_key"`
+	ProjectID   uint   `json:"projectId" gorm:"uniqueIndex:idx_project_sample"`
+	Name        string `json:"name" gorm:"uniqueIndex:idx_project_sample"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	Data        []byte `json:"-"`
+	CreatedAt   time.Time
+}
+
+// SLICES
+type ProjectSampleInfo struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	CreatedAt   string `json:"createdAt"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// DATABASE SCHEMA
+// ProjectVersion is a snapshot of a project's pipeline, taken every time it is saved
+type ProjectVersion struct {
+	ID             uint           `json:"id" gorm:"primary_key"`
+	ProjectID      uint           `json:"projectId" gorm:"uniqueIndex:idx_project_version"`
+	Version        int            `json:"version" gorm:"uniqueIndex:idx_project_version"` // counts up from 1 per project
+	AuthorID       uint           `json:"authorId"`
+	AuthorUsername string         `json:"authorUsername"`
+	Message        string         `json:"message"`
+	Autosave       bool           `json:"autosave"` // autosaves are pruned, named versions are kept
+	Data           datatypes.JSON `json:"data" gorm:"type:json"`
+	CreatedAt      time.Time
+}
+
+// SLICES
+type ProjectVersionInfo struct {
+	ID             uint   `json:"id"`
+	Version        int    `json:"version"`
+	AuthorID       uint   `json:"authorId"`
+	AuthorUsername string `json:"authorUsername"`
+	Message        string `json:"message"`
+	Autosave       bool   `json:"autosave"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// ProjectRestoreInput is the optional body of a version restore, checked like a save
+type ProjectRestoreInput struct {
+	BaseVersion   int    `json:"baseVersion"`
+	BaseUpdatedAt string `json:"baseUpdatedAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// DATABASE SCHEMA
+// ShareLink lets anyone holding its token read a project without an account
+type ShareLink struct {
+	ID          uint       `json:"id" gorm:"primary_key"`
+	ProjectID   uint       `json:"projectId" gorm:"index"`
+	Token       string     `json:"token" gorm:"uniqueIndex"`
+	CreatedByID uint       `json:"createdById"`
+	ExpiresAt   *time.Time `json:"expiresAt"` // nil for links that never expire
+	RevokedAt   *time.Time `json:"revokedAt"`
+	CreatedAt   time.Time
+}
+
+// SLICES
+type ShareLinkInput struct {
+	ExpiresInHours int `json:"expiresInHours"` // 0 for a link that never expires
+}
+type ShareLinkInfo struct {
+	ID        uint   `json:"id"`
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
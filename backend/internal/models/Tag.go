@@ -0,0 +1,14 @@
+package models
+
+// DATABASE SCHEMA
+// Tag is a label shared by every project that uses the same name, see project_tags
+type Tag struct {
+	ID   uint   `json:"id" gorm:"primary_key"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+}
+
+// SLICES
+type TagInfo struct {
+	Name         string `json:"name"`
+	ProjectCount int    `json:"projectCount"`
+}
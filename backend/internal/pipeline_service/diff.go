@@ -0,0 +1,180 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// PipelineDiff is what changed going from one pipeline to another. Nodes are matched by
+// ID. Edges are matched by what they connect rather than by ID, since the editor
+// regenerates edge IDs freely. Layout (node positions) is not part of the diff.
+type PipelineDiff struct {
+	AddedNodes    []models.PipelineNode `json:"addedNodes"`
+	RemovedNodes  []models.PipelineNode `json:"removedNodes"`
+	ModifiedNodes []NodeChange          `json:"modifiedNodes"`
+	AddedEdges    []models.PipelineEdge `json:"addedEdges"`
+	RemovedEdges  []models.PipelineEdge `json:"removedEdges"`
+}
+
+// NodeChange lists the differences in a node present in both pipelines. Name and
+// CvNodeType are only set when they changed.
+type NodeChange struct {
+	NodeID     string          `json:"nodeId"`
+	Name       *StringChange   `json:"name,omitempty"`
+	CvNodeType *NodeTypeChange `json:"cvNodeType,omitempty"`
+	Params     []ParamChange   `json:"params,omitempty"`
+}
+
+type StringChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type NodeTypeChange struct {
+	Old models.CvNodeType `json:"old"`
+	New models.CvNodeType `json:"new"`
+}
+
+// ParamChange is one param that was added, removed or changed. Old is null for added
+// params and New is null for removed ones.
+type ParamChange struct {
+	Param string            `json:"param"`
+	Old   models.ParamValue `json:"old"`
+	New   models.ParamValue `json:"new"`
+}
+
+// Empty reports whether the two pipelines are structurally the same
+func (d *PipelineDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ModifiedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Diff compares two pipelines. The lists in the result follow the node and edge order of
+// whichever pipeline the items come from.
+func Diff(oldPipeline models.PipelineData, newPipeline models.PipelineData) PipelineDiff {
+	diff := PipelineDiff{
+		AddedNodes:    []models.PipelineNode{},
+		RemovedNodes:  []models.PipelineNode{},
+		ModifiedNodes: []NodeChange{},
+		AddedEdges:    []models.PipelineEdge{},
+		RemovedEdges:  []models.PipelineEdge{},
+	}
+
+	// nodes
+	for _, oldNode := range oldPipeline.Nodes {
+		if newPipeline.NodeByID(oldNode.ID) == nil {
+			diff.RemovedNodes = append(diff.RemovedNodes, oldNode)
+		}
+	}
+	for _, newNode := range newPipeline.Nodes {
+		oldNode := oldPipeline.NodeByID(newNode.ID)
+		if oldNode == nil {
+			diff.AddedNodes = append(diff.AddedNodes, newNode)
+			continue
+		}
+		if change, changed := diffNode(*oldNode, newNode); changed {
+			diff.ModifiedNodes = append(diff.ModifiedNodes, change)
+		}
+	}
+
+	// edges
+	oldEdges := map[edgeKey]int{}
+	for _, edge := range oldPipeline.Edges {
+		oldEdges[keyOf(edge)]++
+	}
+	newEdges := map[edgeKey]int{}
+	for _, edge := range newPipeline.Edges {
+		newEdges[keyOf(edge)]++
+	}
+	for _, edge := range oldPipeline.Edges {
+		key := keyOf(edge)
+		if newEdges[key] > 0 {
+			newEdges[key]--
+			continue
+		}
+		diff.RemovedEdges = append(diff.RemovedEdges, edge)
+	}
+	for _, edge := range newPipeline.Edges {
+		key := keyOf(edge)
+		if oldEdges[key] > 0 {
+			oldEdges[key]--
+			continue
+		}
+		diff.AddedEdges = append(diff.AddedEdges, edge)
+	}
+
+	return diff
+}
+
+func diffNode(oldNode models.PipelineNode, newNode models.PipelineNode) (NodeChange, bool) {
+	change := NodeChange{NodeID: newNode.ID}
+	changed := false
+
+	if oldNode.Data.Name != newNode.Data.Name {
+		change.Name = &StringChange{Old: oldNode.Data.Name, New: newNode.Data.Name}
+		changed = true
+	}
+	if oldNode.Data.CvNodeType != newNode.Data.CvNodeType {
+		change.CvNodeType = &NodeTypeChange{Old: oldNode.Data.CvNodeType, New: newNode.Data.CvNodeType}
+		changed = true
+	}
+
+	for _, name := range sortedParamNames(oldNode.Data.Params) {
+		if _, ok := newNode.Data.Params[name]; !ok {
+			change.Params = append(change.Params, ParamChange{Param: name, Old: oldNode.Data.Params[name]})
+		}
+	}
+	for _, name := range sortedParamNames(newNode.Data.Params) {
+		newValue := newNode.Data.Params[name]
+		oldValue, ok := oldNode.Data.Params[name]
+		if !ok {
+			change.Params = append(change.Params, ParamChange{Param: name, New: newValue})
+		} else if !sameParamValue(oldValue, newValue) {
+			change.Params = append(change.Params, ParamChange{Param: name, Old: oldValue, New: newValue})
+		}
+	}
+	if len(change.Params) > 0 {
+		changed = true
+	}
+
+	return change, changed
+}
+
+// sameParamValue compares params by value, so 5 and 5.0 or reordered object keys are equal
+func sameParamValue(a models.ParamValue, b models.ParamValue) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func sortedParamNames(params map[string]models.ParamValue) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// edgeKey identifies an edge by the handles it connects
+type edgeKey struct {
+	source       string
+	sourceHandle string
+	target       string
+	targetHandle string
+}
+
+func keyOf(edge models.PipelineEdge) edgeKey {
+	key := edgeKey{source: edge.Source, target: edge.Target}
+	if edge.SourceHandle != nil {
+		key.sourceHandle = *edge.SourceHandle
+	}
+	if edge.TargetHandle != nil {
+		key.targetHandle = *edge.TargetHandle
+	}
+	return key
+}
@@ -0,0 +1,160 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"testing"
+)
+
+const diffBase = `{"nodes":[
+	{"id":"s","position":{"x":0,"y":0},"data":{"name":"Source","cvNodeType":"source"}},
+	{"id":"b","position":{"x":100,"y":0},"data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+	{"id":"o","position":{"x":200,"y":0},"data":{"name":"Output","cvNodeType":"output"}}],
+	"edges":[{"id":"e1","source":"s","target":"b"},{"id":"e2","source":"b","target":"o"}]}`
+
+func nodeIDs(nodes []models.PipelineNode) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
+}
+
+func edgeEnds(edges []models.PipelineEdge) []string {
+	ends := make([]string, len(edges))
+	for i, edge := range edges {
+		ends[i] = edge.Source + ">" + edge.Target
+	}
+	return ends
+}
+
+func assertStrings(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	base := pipelineFrom(t, diffBase)
+	diff := Diff(base, pipelineFrom(t, diffBase))
+	if !diff.Empty() {
+		t.Fatalf("diff of identical pipelines is not empty: %+v", diff)
+	}
+}
+
+func TestDiffIgnoresLayoutAndEdgeIDs(t *testing.T) {
+	moved := pipelineFrom(t, `{"nodes":[
+		{"id":"s","position":{"x":50,"y":50},"data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","position":{"x":150,"y":90},"data":{"name":"Blur","cvNodeType":"blur","params":{"size":5.0}}},
+		{"id":"o","position":{"x":250,"y":10},"data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"id":"other","source":"b","target":"o"},{"id":"ids","source":"s","target":"b"}]}`)
+
+	diff := Diff(pipelineFrom(t, diffBase), moved)
+	if !diff.Empty() {
+		t.Fatalf("moving nodes, renaming edges and writing 5 as 5.0 changed the diff: %+v", diff)
+	}
+}
+
+func TestDiffNodesAndEdges(t *testing.T) {
+	changed := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"f","data":{"name":"Fry","cvNodeType":"deepfry"}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"f"},{"source":"f","target":"o"}]}`)
+
+	diff := Diff(pipelineFrom(t, diffBase), changed)
+	assertStrings(t, "added nodes", nodeIDs(diff.AddedNodes), "f")
+	assertStrings(t, "removed nodes", nodeIDs(diff.RemovedNodes), "b")
+	assertStrings(t, "added edges", edgeEnds(diff.AddedEdges), "s>f", "f>o")
+	assertStrings(t, "removed edges", edgeEnds(diff.RemovedEdges), "s>b", "b>o")
+	if len(diff.ModifiedNodes) != 0 {
+		t.Fatalf("modified nodes = %+v, want none", diff.ModifiedNodes)
+	}
+}
+
+func TestDiffNodeFields(t *testing.T) {
+	changed := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Input","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"deepfry","params":{"size":7,"strength":2}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output","params":{}}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+
+	diff := Diff(pipelineFrom(t, diffBase), changed)
+	if len(diff.ModifiedNodes) != 2 {
+		t.Fatalf("modified nodes = %+v, want s and b", diff.ModifiedNodes)
+	}
+
+	source := diff.ModifiedNodes[0]
+	if source.NodeID != "s" || source.Name == nil || source.Name.Old != "Source" || source.Name.New != "Input" {
+		t.Fatalf("source change = %+v, want a rename to Input", source)
+	}
+	if source.CvNodeType != nil || len(source.Params) != 0 {
+		t.Fatalf("source change = %+v, want only the name", source)
+	}
+
+	blur := diff.ModifiedNodes[1]
+	if blur.NodeID != "b" || blur.Name != nil {
+		t.Fatalf("blur change = %+v", blur)
+	}
+	if blur.CvNodeType == nil || blur.CvNodeType.Old != models.CvNodeBlur || blur.CvNodeType.New != models.CvNodeDeepFry {
+		t.Fatalf("blur type change = %+v, want blur to deepfry", blur.CvNodeType)
+	}
+	if len(blur.Params) != 2 {
+		t.Fatalf("blur param changes = %+v, want size and strength", blur.Params)
+	}
+	size, strength := blur.Params[0], blur.Params[1]
+	if size.Param != "size" || string(size.Old) != "5" || string(size.New) != "7" {
+		t.Errorf("size change = %s: %s -> %s", size.Param, size.Old, size.New)
+	}
+	if strength.Param != "strength" || strength.Old != nil || string(strength.New) != "2" {
+		t.Errorf("strength change = %s: %s -> %s", strength.Param, strength.Old, strength.New)
+	}
+}
+
+func TestDiffRemovedParam(t *testing.T) {
+	changed := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+
+	diff := Diff(pipelineFrom(t, diffBase), changed)
+	if len(diff.ModifiedNodes) != 1 || len(diff.ModifiedNodes[0].Params) != 1 {
+		t.Fatalf("modified nodes = %+v, want size removed from b", diff.ModifiedNodes)
+	}
+	removed := diff.ModifiedNodes[0].Params[0]
+	if removed.Param != "size" || string(removed.Old) != "5" || removed.New != nil {
+		t.Fatalf("param change = %s: %s -> %s, want size removed", removed.Param, removed.Old, removed.New)
+	}
+}
+
+func TestDiffDuplicateEdges(t *testing.T) {
+	doubled := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"},{"source":"b","target":"o"}]}`)
+
+	diff := Diff(pipelineFrom(t, diffBase), doubled)
+	assertStrings(t, "added edges", edgeEnds(diff.AddedEdges), "b>o")
+	assertStrings(t, "removed edges", edgeEnds(diff.RemovedEdges))
+
+	diff = Diff(doubled, pipelineFrom(t, diffBase))
+	assertStrings(t, "added edges", edgeEnds(diff.AddedEdges))
+	assertStrings(t, "removed edges", edgeEnds(diff.RemovedEdges), "b>o")
+}
+
+func TestDiffEdgeHandles(t *testing.T) {
+	base := pipelineFrom(t, `{"nodes":[],"edges":[{"source":"a","target":"b","sourceHandle":"out-0"}]}`)
+	moved := pipelineFrom(t, `{"nodes":[],"edges":[{"source":"a","target":"b","sourceHandle":"out-1"}]}`)
+
+	diff := Diff(base, moved)
+	if len(diff.AddedEdges) != 1 || len(diff.RemovedEdges) != 1 {
+		t.Fatalf("moving an edge to another handle gave %+v", diff)
+	}
+}
@@ -0,0 +1,164 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+)
+
+// MergeConflict is an upstream change that Merge left out because the local pipeline
+// changed the same thing. Param is only set for conflicting params.
+type MergeConflict struct {
+	NodeID string `json:"nodeId,omitempty"`
+	Param  string `json:"param,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Merge applies the changes made going from base to theirs onto ours, a three way merge
+// at the granularity of nodes, node fields, params and edges. Where ours changed the
+// same thing differently, ours is kept and a conflict is reported. Layout always comes
+// from ours.
+func Merge(base models.PipelineData, ours models.PipelineData, theirs models.PipelineData) (models.PipelineData, []MergeConflict) {
+	upstream := Diff(base, theirs)
+	merged := models.PipelineData{
+		Nodes:         append([]models.PipelineNode(nil), ours.Nodes...),
+		Edges:         append([]models.PipelineEdge(nil), ours.Edges...),
+		SchemaVersion: ours.SchemaVersion,
+		Extra:         ours.Extra,
+	}
+	conflicts := []MergeConflict{}
+
+	// nodes
+	for _, removed := range upstream.RemovedNodes {
+		local := merged.NodeByID(removed.ID)
+		if local == nil {
+			continue
+		}
+		if _, changed := diffNode(removed, *local); changed {
+			conflicts = append(conflicts, MergeConflict{NodeID: removed.ID, Reason: "removed upstream but changed locally"})
+			continue
+		}
+		removeNode(&merged, removed.ID)
+	}
+	for _, added := range upstream.AddedNodes {
+		local := merged.NodeByID(added.ID)
+		if local == nil {
+			merged.Nodes = append(merged.Nodes, added)
+			continue
+		}
+		if _, changed := diffNode(*local, added); changed {
+			conflicts = append(conflicts, MergeConflict{NodeID: added.ID, Reason: "added both upstream and locally with different settings"})
+		}
+	}
+	for _, change := range upstream.ModifiedNodes {
+		local := merged.NodeByID(change.NodeID)
+		if local == nil {
+			conflicts = append(conflicts, MergeConflict{NodeID: change.NodeID, Reason: "changed upstream but removed locally"})
+			continue
+		}
+		conflicts = append(conflicts, applyNodeChange(local, change)...)
+	}
+
+	// edges
+	for _, removed := range upstream.RemovedEdges {
+		key := keyOf(removed)
+		for i, edge := range merged.Edges {
+			if keyOf(edge) == key {
+				merged.Edges = append(merged.Edges[:i:i], merged.Edges[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, added := range upstream.AddedEdges {
+		key := keyOf(added)
+		exists := false
+		for _, edge := range merged.Edges {
+			if keyOf(edge) == key {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		if merged.NodeByID(added.Source) == nil || merged.NodeByID(added.Target) == nil {
+			conflicts = append(conflicts, MergeConflict{NodeID: added.Target, Reason: "edge added upstream connects a node removed locally"})
+			continue
+		}
+		merged.Edges = append(merged.Edges, added)
+	}
+
+	return merged, conflicts
+}
+
+// applyNodeChange applies one upstream node change to the local copy of the node, field
+// by field, skipping the fields the local node changed itself
+func applyNodeChange(local *models.PipelineNode, change NodeChange) []MergeConflict {
+	var conflicts []MergeConflict
+
+	if change.Name != nil {
+		if local.Data.Name == change.Name.Old {
+			local.Data.Name = change.Name.New
+		} else if local.Data.Name != change.Name.New {
+			conflicts = append(conflicts, MergeConflict{NodeID: change.NodeID, Reason: "name changed both upstream and locally"})
+		}
+	}
+	if change.CvNodeType != nil {
+		if local.Data.CvNodeType == change.CvNodeType.Old {
+			local.Data.CvNodeType = change.CvNodeType.New
+		} else if local.Data.CvNodeType != change.CvNodeType.New {
+			conflicts = append(conflicts, MergeConflict{NodeID: change.NodeID, Reason: "node type changed both upstream and locally"})
+		}
+	}
+
+	if len(change.Params) == 0 {
+		return conflicts
+	}
+	// the node was copied from ours by value, but its params map is still shared
+	params := make(map[string]models.ParamValue, len(local.Data.Params))
+	for name, value := range local.Data.Params {
+		params[name] = value
+	}
+	for _, paramChange := range change.Params {
+		value, ok := params[paramChange.Param]
+		switch {
+		case sameOptionalParam(value, ok, paramChange.Old):
+			if paramChange.New == nil {
+				delete(params, paramChange.Param)
+			} else {
+				params[paramChange.Param] = paramChange.New
+			}
+		case sameOptionalParam(value, ok, paramChange.New):
+			// already made the same change locally
+		default:
+			conflicts = append(conflicts, MergeConflict{NodeID: change.NodeID, Param: paramChange.Param, Reason: "param changed both upstream and locally"})
+		}
+	}
+	local.Data.Params = params
+
+	return conflicts
+}
+
+// sameOptionalParam compares a param that may be missing against a ParamChange side,
+// where nil means missing
+func sameOptionalParam(value models.ParamValue, ok bool, other models.ParamValue) bool {
+	if !ok || other == nil {
+		return !ok && other == nil
+	}
+	return sameParamValue(value, other)
+}
+
+// removeNode drops a node and every edge attached to it
+func removeNode(pipeline *models.PipelineData, id string) {
+	nodes := pipeline.Nodes[:0:0]
+	for _, node := range pipeline.Nodes {
+		if node.ID != id {
+			nodes = append(nodes, node)
+		}
+	}
+	edges := pipeline.Edges[:0:0]
+	for _, edge := range pipeline.Edges {
+		if edge.Source != id && edge.Target != id {
+			edges = append(edges, edge)
+		}
+	}
+	pipeline.Nodes, pipeline.Edges = nodes, edges
+}
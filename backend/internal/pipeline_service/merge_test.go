@@ -0,0 +1,175 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"testing"
+)
+
+func conflictReasons(conflicts []MergeConflict) []string {
+	reasons := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		reasons[i] = conflict.NodeID + "." + conflict.Param + ": " + conflict.Reason
+	}
+	return reasons
+}
+
+func TestMergeUnchanged(t *testing.T) {
+	ours := pipelineFrom(t, diffBase)
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), ours, pipelineFrom(t, diffBase))
+	assertStrings(t, "conflicts", conflictReasons(conflicts))
+	if diff := Diff(ours, merged); !diff.Empty() {
+		t.Fatalf("merging an unchanged upstream changed ours: %+v", diff)
+	}
+}
+
+func TestMergeAppliesUpstreamChanges(t *testing.T) {
+	ours := pipelineFrom(t, `{"viewport":{"x":0,"y":0,"zoom":2},"nodes":[
+		{"id":"s","position":{"x":10,"y":10},"data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","position":{"x":110,"y":10},"data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+		{"id":"o","position":{"x":210,"y":10},"data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+	theirs := pipelineFrom(t, `{"viewport":{"x":50,"y":50,"zoom":1},"nodes":[
+		{"id":"s","data":{"name":"Input","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":9}}},
+		{"id":"f","data":{"name":"Fry","cvNodeType":"deepfry"}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"f"},{"source":"f","target":"o"}]}`)
+
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), ours, theirs)
+	assertStrings(t, "conflicts", conflictReasons(conflicts))
+	assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "b", "o", "f")
+	assertStrings(t, "edges", edgeEnds(merged.Edges), "s>b", "b>f", "f>o")
+
+	if name := merged.NodeByID("s").Data.Name; name != "Input" {
+		t.Errorf("source name = %q, want the upstream rename", name)
+	}
+	if size := string(merged.NodeByID("b").Data.Params["size"]); size != "9" {
+		t.Errorf("blur size = %s, want the upstream 9", size)
+	}
+	if x := merged.NodeByID("b").Position.X; x != 110 {
+		t.Errorf("blur x = %v, want the local layout", x)
+	}
+	if viewport := string(merged.Extra["viewport"]); viewport != `{"x":0,"y":0,"zoom":2}` {
+		t.Errorf("viewport = %s, want the local one", viewport)
+	}
+	if size := string(ours.NodeByID("b").Data.Params["size"]); size != "5" {
+		t.Errorf("merging changed the params of ours to %s", size)
+	}
+}
+
+func TestMergeKeepsOursOnConflict(t *testing.T) {
+	ours := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Mine","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":3}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+	theirs := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Theirs","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":9}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), ours, theirs)
+	assertStrings(t, "conflicts", conflictReasons(conflicts),
+		"s.: name changed both upstream and locally",
+		"b.size: param changed both upstream and locally")
+
+	if name := merged.NodeByID("s").Data.Name; name != "Mine" {
+		t.Errorf("source name = %q, want ours kept", name)
+	}
+	if size := string(merged.NodeByID("b").Data.Params["size"]); size != "3" {
+		t.Errorf("blur size = %s, want ours kept", size)
+	}
+}
+
+func TestMergeSameChangeOnBothSides(t *testing.T) {
+	both := `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":9}}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`
+
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), pipelineFrom(t, both), pipelineFrom(t, both))
+	assertStrings(t, "conflicts", conflictReasons(conflicts))
+	if size := string(merged.NodeByID("b").Data.Params["size"]); size != "9" {
+		t.Errorf("blur size = %s, want 9", size)
+	}
+}
+
+func TestMergeRemovedNodes(t *testing.T) {
+	theirs := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"o"}]}`)
+
+	t.Run("unchanged locally", func(t *testing.T) {
+		merged, conflicts := Merge(pipelineFrom(t, diffBase), pipelineFrom(t, diffBase), theirs)
+		assertStrings(t, "conflicts", conflictReasons(conflicts))
+		assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "o")
+		assertStrings(t, "edges", edgeEnds(merged.Edges), "s>o")
+	})
+
+	t.Run("changed locally", func(t *testing.T) {
+		ours := pipelineFrom(t, `{"nodes":[
+			{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+			{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":7}}},
+			{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+			"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+
+		merged, conflicts := Merge(pipelineFrom(t, diffBase), ours, theirs)
+		assertStrings(t, "conflicts", conflictReasons(conflicts), "b.: removed upstream but changed locally")
+		assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "b", "o")
+	})
+
+	t.Run("changed upstream, removed locally", func(t *testing.T) {
+		changed := pipelineFrom(t, `{"nodes":[
+			{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+			{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":7}}},
+			{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+			"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+
+		merged, conflicts := Merge(pipelineFrom(t, diffBase), theirs, changed)
+		assertStrings(t, "conflicts", conflictReasons(conflicts), "b.: changed upstream but removed locally")
+		assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "o")
+	})
+}
+
+func TestMergeAddedNodes(t *testing.T) {
+	withFry := func(params string) models.PipelineData {
+		return pipelineFrom(t, `{"nodes":[
+			{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+			{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+			{"id":"f","data":{"name":"Fry","cvNodeType":"deepfry","params":`+params+`}},
+			{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+			"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`)
+	}
+
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), withFry(`{"strength":1}`), withFry(`{"strength":1}`))
+	assertStrings(t, "conflicts", conflictReasons(conflicts))
+	assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "b", "f", "o")
+
+	merged, conflicts = Merge(pipelineFrom(t, diffBase), withFry(`{"strength":1}`), withFry(`{"strength":4}`))
+	assertStrings(t, "conflicts", conflictReasons(conflicts), "f.: added both upstream and locally with different settings")
+	if strength := string(merged.NodeByID("f").Data.Params["strength"]); strength != "1" {
+		t.Errorf("fry strength = %s, want ours kept", strength)
+	}
+}
+
+func TestMergeEdgeToRemovedNode(t *testing.T) {
+	// upstream wires a new node in after the blur, which was removed locally
+	ours := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"o"}]}`)
+	theirs := pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"name":"Source","cvNodeType":"source"}},
+		{"id":"b","data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+		{"id":"f","data":{"name":"Fry","cvNodeType":"deepfry"}},
+		{"id":"o","data":{"name":"Output","cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"f"},{"source":"f","target":"o"}]}`)
+
+	merged, conflicts := Merge(pipelineFrom(t, diffBase), ours, theirs)
+	assertStrings(t, "conflicts", conflictReasons(conflicts), "f.: edge added upstream connects a node removed locally")
+	assertStrings(t, "nodes", nodeIDs(merged.Nodes), "s", "o", "f")
+	assertStrings(t, "edges", edgeEnds(merged.Edges), "s>o", "f>o")
+}
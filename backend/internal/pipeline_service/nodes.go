@@ -0,0 +1,174 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+)
+
+// The node registry is the single source of truth for node types. The editor builds its
+// palette from GET /api/nodes and Validate checks pipelines against the same
+// definitions, so only cvNodeTypeFromKey and executeCvOperation in cv.cpp have to be
+// kept in sync by hand when a node type is added.
+
+type ParamKind string
+
+const (
+	ParamInt    ParamKind = "int"
+	ParamNumber ParamKind = "number"
+	ParamBool   ParamKind = "bool"
+)
+
+// ParamControl is the editor control a param is shown with, like ParamControlStyle in
+// the frontend
+type ParamControl string
+
+const (
+	ControlIntBox    ParamControl = "intBox"
+	ControlNumBox    ParamControl = "numBox"
+	ControlIntSlider ParamControl = "intSlider"
+	ControlNumSlider ParamControl = "numSlider"
+	ControlToggle    ParamControl = "toggle"
+)
+
+type ParamDefinition struct {
+	Key         string              `json:"key"`
+	DisplayName string              `json:"displayName"`
+	Description string              `json:"description"`
+	Kind        ParamKind           `json:"kind"`
+	Control     ParamControl        `json:"control"`
+	Required    bool                `json:"required"`
+	Default     models.ParamValue   `json:"default"`
+	Min         *float64            `json:"min,omitempty"`
+	Max         *float64            `json:"max,omitempty"`
+	Options     []models.ParamValue `json:"options,omitempty"`
+}
+
+type NodeDefinition struct {
+	Key         models.CvNodeType `json:"key"`
+	DisplayName string            `json:"displayName"`
+	Description string            `json:"description"`
+	Inputs      int               `json:"inputs"`
+	Outputs     int               `json:"outputs"`
+	Params      []ParamDefinition `json:"params"`
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+// paramValue encodes a registry default or option, which are all plain Go values
+func paramValue(v interface{}) models.ParamValue {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return models.ParamValue(b)
+}
+
+// nodeRegistry lists the node types in palette order
+var nodeRegistry = []NodeDefinition{
+	{
+		Key:         models.CvNodeSource,
+		DisplayName: "Source",
+		Description: "The input image",
+		Inputs:      0,
+		Outputs:     1,
+		Params:      []ParamDefinition{},
+	},
+	{
+		Key:         models.CvNodeOutput,
+		DisplayName: "Output",
+		Description: "The final image",
+		Inputs:      1,
+		Outputs:     0,
+		Params:      []ParamDefinition{},
+	},
+	{
+		Key:         models.CvNodeBlur,
+		DisplayName: "Blur",
+		Description: "Box blurs the image",
+		Inputs:      1,
+		Outputs:     1,
+		Params: []ParamDefinition{
+			{
+				Key:         "size",
+				DisplayName: "Kernel size",
+				Description: "The higher the value, the stronger the blur",
+				Kind:        ParamInt,
+				Control:     ControlIntBox,
+				Required:    true,
+				Default:     paramValue(5),
+				Min:         floatPtr(1),
+			},
+		},
+	},
+	{
+		Key:         models.CvNodeDeepFry,
+		DisplayName: "Deep Fry",
+		Description: "Boosts contrast, sharpens, oversaturates and posterizes the image",
+		Inputs:      1,
+		Outputs:     1,
+		Params:      []ParamDefinition{},
+	},
+}
+
+var nodesByKey = map[models.CvNodeType]*NodeDefinition{}
+
+func init() {
+	for i := range nodeRegistry {
+		nodesByKey[nodeRegistry[i].Key] = &nodeRegistry[i]
+	}
+}
+
+// Nodes returns a copy of every node type in palette order, callers can't change the
+// registry through it
+func Nodes() []NodeDefinition {
+	nodes := make([]NodeDefinition, len(nodeRegistry))
+	for i, node := range nodeRegistry {
+		nodes[i] = node.clone()
+	}
+	return nodes
+}
+
+func (n NodeDefinition) clone() NodeDefinition {
+	params := make([]ParamDefinition, len(n.Params))
+	for i, param := range n.Params {
+		params[i] = param.clone()
+	}
+	n.Params = params
+	return n
+}
+
+func (p ParamDefinition) clone() ParamDefinition {
+	p.Default = cloneParamValue(p.Default)
+	if p.Min != nil {
+		p.Min = floatPtr(*p.Min)
+	}
+	if p.Max != nil {
+		p.Max = floatPtr(*p.Max)
+	}
+	if p.Options != nil {
+		options := make([]models.ParamValue, len(p.Options))
+		for i, option := range p.Options {
+			options[i] = cloneParamValue(option)
+		}
+		p.Options = options
+	}
+	return p
+}
+
+func cloneParamValue(v models.ParamValue) models.ParamValue {
+	if v == nil {
+		return nil
+	}
+	return append(models.ParamValue(nil), v...)
+}
+
+// LookupNode returns a copy of the definition of a node type, or false if there is no
+// such type
+func LookupNode(key models.CvNodeType) (*NodeDefinition, bool) {
+	node, ok := nodesByKey[key]
+	if !ok {
+		return nil, false
+	}
+	copied := node.clone()
+	return &copied, true
+}
@@ -0,0 +1,64 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"testing"
+)
+
+// mutate changes everything a caller could reach in a node definition
+func mutate(node *NodeDefinition) {
+	node.DisplayName = "changed"
+	for i := range node.Params {
+		param := &node.Params[i]
+		param.Key = "changed"
+		param.Default[0] = '9'
+		if param.Min != nil {
+			*param.Min = -1
+		}
+	}
+	node.Params = append(node.Params, ParamDefinition{Key: "extra"})
+}
+
+// assertRegistryIntact checks the registry itself, not a copy of it
+func assertRegistryIntact(t *testing.T) {
+	t.Helper()
+	if nodeRegistry[0].DisplayName != "Source" {
+		t.Fatalf("source is now called %q", nodeRegistry[0].DisplayName)
+	}
+	blur := nodesByKey[models.CvNodeBlur]
+	if blur.DisplayName != "Blur" || len(blur.Params) != 1 {
+		t.Fatalf("blur definition changed: %+v", blur)
+	}
+	size := blur.Params[0]
+	if size.Key != "size" || string(size.Default) != "5" || *size.Min != 1 {
+		t.Fatalf("blur size definition changed: %+v", size)
+	}
+}
+
+func TestNodesReturnsCopy(t *testing.T) {
+	nodes := Nodes()
+	for i := range nodes {
+		mutate(&nodes[i])
+	}
+	assertRegistryIntact(t)
+}
+
+func TestLookupNodeReturnsCopy(t *testing.T) {
+	blur, ok := LookupNode(models.CvNodeBlur)
+	if !ok {
+		t.Fatal("blur is not registered")
+	}
+	mutate(blur)
+	assertRegistryIntact(t)
+
+	again, _ := LookupNode(models.CvNodeBlur)
+	if again == blur {
+		t.Fatal("LookupNode returned the same definition twice")
+	}
+}
+
+func TestLookupNodeUnknown(t *testing.T) {
+	if node, ok := LookupNode("sharpen"); ok || node != nil {
+		t.Fatalf("LookupNode found %+v for an unknown type", node)
+	}
+}
@@ -0,0 +1,158 @@
+package pipeline_service
+
+import (
+	"bytes"
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Stored pipelines carry the schemaVersion they were saved with. Whenever the shape of a
+// pipeline changes (node type numbering, param names, ...) CurrentSchemaVersion goes up
+// and a migration is appended to pipelineMigrations. Pipelines are upgraded as they are
+// read, so old projects keep working without rewriting every row. Pipelines from before
+// versioning have no schemaVersion and count as version 0.
+
+const CurrentSchemaVersion = 2
+
+// ErrFutureSchema is returned for pipelines saved by a newer server than this one
+var ErrFutureSchema = errors.New("pipeline schema version is newer than this server supports")
+
+// pipelineDoc is a pipeline as generic JSON, the only shape every version fits. Numbers
+// are kept as json.Number so ints stay ints.
+type pipelineDoc map[string]interface{}
+
+type pipelineMigration struct {
+	description string
+	// apply upgrades a pipeline from its index in pipelineMigrations to the next version
+	apply func(doc pipelineDoc) error
+}
+
+var pipelineMigrations = []pipelineMigration{
+	{description: "stamp pipelines saved before versioning", apply: migrateV0},
+	{description: "replace integer node types with string keys", apply: migrateV1},
+}
+
+func init() {
+	if len(pipelineMigrations) != CurrentSchemaVersion {
+		panic(fmt.Sprintf("pipeline_service: %d migrations for schema version %d", len(pipelineMigrations), CurrentSchemaVersion))
+	}
+}
+
+// MigratePipeline upgrades stored pipeline JSON to CurrentSchemaVersion, returning the
+// upgraded JSON and the version it started at. Current pipelines come back unchanged.
+func MigratePipeline(data []byte) ([]byte, int, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, CurrentSchemaVersion, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc pipelineDoc
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, 0, err
+	}
+	if doc == nil {
+		return data, CurrentSchemaVersion, nil
+	}
+
+	from, err := schemaVersionOf(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if from > CurrentSchemaVersion {
+		return nil, from, fmt.Errorf("%w: %d > %d", ErrFutureSchema, from, CurrentSchemaVersion)
+	}
+	if from == CurrentSchemaVersion {
+		return data, from, nil
+	}
+
+	for version := from; version < CurrentSchemaVersion; version++ {
+		if err := pipelineMigrations[version].apply(doc); err != nil {
+			return nil, from, fmt.Errorf("migrating pipeline from version %d (%s): %w", version, pipelineMigrations[version].description, err)
+		}
+		doc["schemaVersion"] = version + 1
+	}
+
+	migrated, err := json.Marshal(doc)
+	return migrated, from, err
+}
+
+// DecodePipeline migrates stored pipeline JSON and decodes it
+func DecodePipeline(data []byte) (models.PipelineData, error) {
+	var pipeline models.PipelineData
+	migrated, _, err := MigratePipeline(data)
+	if err != nil {
+		return pipeline, err
+	}
+	if len(bytes.TrimSpace(migrated)) > 0 {
+		if err := json.Unmarshal(migrated, &pipeline); err != nil {
+			return pipeline, err
+		}
+	}
+	pipeline.SchemaVersion = CurrentSchemaVersion
+	return pipeline, nil
+}
+
+func schemaVersionOf(doc pipelineDoc) (int, error) {
+	raw, ok := doc["schemaVersion"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	number, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid schemaVersion %v", raw)
+	}
+	version, err := number.Int64()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid schemaVersion %v", raw)
+	}
+	return int(version), nil
+}
+
+// nodeData returns the data object of every node that has one
+func nodeData(doc pipelineDoc) []map[string]interface{} {
+	nodes, _ := doc["nodes"].([]interface{})
+	var data []map[string]interface{}
+	for _, node := range nodes {
+		nodeMap, ok := node.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if d, ok := nodeMap["data"].(map[string]interface{}); ok {
+			data = append(data, d)
+		}
+	}
+	return data
+}
+
+// ====================================================================================================
+// MIGRATIONS
+
+// migrateV0 only stamps the version. Version 1 is the shape pipelines were saved in
+// before they carried a schemaVersion, so there is nothing to rewrite.
+func migrateV0(doc pipelineDoc) error {
+	return nil
+}
+
+// migrateV1 replaces the integer node types of the old enum with their keys. Integers
+// the enum never had are kept as text so validation reports them as unknown types.
+func migrateV1(doc pipelineDoc) error {
+	for _, data := range nodeData(doc) {
+		number, ok := data["cvNodeType"].(json.Number)
+		if !ok {
+			continue
+		}
+		legacy, err := number.Int64()
+		if err != nil {
+			return fmt.Errorf("invalid cvNodeType %v", number)
+		}
+		if nodeType, ok := models.CvNodeTypeFromLegacy(int(legacy)); ok {
+			data["cvNodeType"] = string(nodeType)
+		} else {
+			data["cvNodeType"] = number.String()
+		}
+	}
+	return nil
+}
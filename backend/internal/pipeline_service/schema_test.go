@@ -0,0 +1,147 @@
+package pipeline_service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// currentFixture is what every fixture below upgrades to
+const currentFixture = `{"schemaVersion":2,"nodes":[
+	{"id":"s","position":{"x":0,"y":0},"data":{"name":"Source","cvNodeType":"source"}},
+	{"id":"b","position":{"x":100,"y":0},"data":{"name":"Blur","cvNodeType":"blur","params":{"size":5}}},
+	{"id":"f","position":{"x":200,"y":0},"data":{"name":"Fry","cvNodeType":"deepfry","params":{}}},
+	{"id":"o","position":{"x":300,"y":0},"data":{"name":"Output","cvNodeType":"output"}}],
+	"edges":[{"id":"e1","source":"s","target":"b"},{"id":"e2","source":"b","target":"f"},{"id":"e3","source":"f","target":"o"}]}`
+
+var schemaFixtures = []struct {
+	name    string
+	version int
+	in      string
+}{
+	{
+		name:    "v0, saved before versioning",
+		version: 0,
+		in: `{"nodes":[
+			{"id":"s","position":{"x":0,"y":0},"data":{"name":"Source","cvNodeType":0}},
+			{"id":"b","position":{"x":100,"y":0},"data":{"name":"Blur","cvNodeType":2,"params":{"size":5}}},
+			{"id":"f","position":{"x":200,"y":0},"data":{"name":"Fry","cvNodeType":3,"params":{}}},
+			{"id":"o","position":{"x":300,"y":0},"data":{"name":"Output","cvNodeType":1}}],
+			"edges":[{"id":"e1","source":"s","target":"b"},{"id":"e2","source":"b","target":"f"},{"id":"e3","source":"f","target":"o"}]}`,
+	},
+	{
+		name:    "v1, integer node types",
+		version: 1,
+		in: `{"schemaVersion":1,"nodes":[
+			{"id":"s","position":{"x":0,"y":0},"data":{"name":"Source","cvNodeType":0}},
+			{"id":"b","position":{"x":100,"y":0},"data":{"name":"Blur","cvNodeType":2,"params":{"size":5}}},
+			{"id":"f","position":{"x":200,"y":0},"data":{"name":"Fry","cvNodeType":3,"params":{}}},
+			{"id":"o","position":{"x":300,"y":0},"data":{"name":"Output","cvNodeType":1}}],
+			"edges":[{"id":"e1","source":"s","target":"b"},{"id":"e2","source":"b","target":"f"},{"id":"e3","source":"f","target":"o"}]}`,
+	},
+	{
+		name:    "v2, current",
+		version: 2,
+		in:      currentFixture,
+	},
+}
+
+func assertSameJSON(t *testing.T, want string, got []byte) {
+	t.Helper()
+	var wantValue, gotValue interface{}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("bad test JSON: %v", err)
+	}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("got invalid JSON %s: %v", got, err)
+	}
+	if !reflect.DeepEqual(wantValue, gotValue) {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestMigratePipeline(t *testing.T) {
+	for _, fixture := range schemaFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			migrated, from, err := MigratePipeline([]byte(fixture.in))
+			if err != nil {
+				t.Fatalf("MigratePipeline: %v", err)
+			}
+			if from != fixture.version {
+				t.Errorf("migrated from version %d, want %d", from, fixture.version)
+			}
+			assertSameJSON(t, currentFixture, migrated)
+		})
+	}
+}
+
+func TestDecodePipeline(t *testing.T) {
+	want := pipelineFrom(t, currentFixture)
+	for _, fixture := range schemaFixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			pipeline, err := DecodePipeline([]byte(fixture.in))
+			if err != nil {
+				t.Fatalf("DecodePipeline: %v", err)
+			}
+			if pipeline.SchemaVersion != CurrentSchemaVersion {
+				t.Errorf("schemaVersion = %d, want %d", pipeline.SchemaVersion, CurrentSchemaVersion)
+			}
+			if diff := Diff(want, pipeline); !diff.Empty() {
+				t.Errorf("decoded pipeline differs from the current fixture: %+v", diff)
+			}
+		})
+	}
+}
+
+func TestMigratePipelineStampsEveryStep(t *testing.T) {
+	// a v0 pipeline only reaches v2 if both migrations ran in turn
+	migrated, _, err := MigratePipeline([]byte(`{"nodes":[]}`))
+	if err != nil {
+		t.Fatalf("MigratePipeline: %v", err)
+	}
+	assertSameJSON(t, `{"schemaVersion":2,"nodes":[]}`, migrated)
+}
+
+func TestMigratePipelineUnknownLegacyType(t *testing.T) {
+	migrated, _, err := MigratePipeline([]byte(`{"schemaVersion":1,"nodes":[{"id":"a","data":{"cvNodeType":9}}]}`))
+	if err != nil {
+		t.Fatalf("MigratePipeline: %v", err)
+	}
+	assertSameJSON(t, `{"schemaVersion":2,"nodes":[{"id":"a","data":{"cvNodeType":"9"}}]}`, migrated)
+}
+
+func TestMigratePipelineEmpty(t *testing.T) {
+	for _, in := range []string{"", "  ", "null"} {
+		pipeline, err := DecodePipeline([]byte(in))
+		if err != nil {
+			t.Fatalf("DecodePipeline(%q): %v", in, err)
+		}
+		if pipeline.SchemaVersion != CurrentSchemaVersion || len(pipeline.Nodes) != 0 {
+			t.Fatalf("DecodePipeline(%q) = %+v, want an empty current pipeline", in, pipeline)
+		}
+	}
+}
+
+func TestMigratePipelineFutureSchema(t *testing.T) {
+	future := `{"schemaVersion":3,"nodes":[]}`
+
+	_, from, err := MigratePipeline([]byte(future))
+	if !errors.Is(err, ErrFutureSchema) {
+		t.Fatalf("MigratePipeline error = %v, want ErrFutureSchema", err)
+	}
+	if from != 3 {
+		t.Errorf("from = %d, want 3", from)
+	}
+	if _, err := DecodePipeline([]byte(future)); !errors.Is(err, ErrFutureSchema) {
+		t.Fatalf("DecodePipeline error = %v, want ErrFutureSchema", err)
+	}
+}
+
+func TestMigratePipelineInvalidVersion(t *testing.T) {
+	for _, in := range []string{`{"schemaVersion":"2"}`, `{"schemaVersion":-1}`, `{"schemaVersion":1.5}`} {
+		if _, _, err := MigratePipeline([]byte(in)); err == nil {
+			t.Errorf("MigratePipeline(%s) accepted an invalid schemaVersion", in)
+		}
+	}
+}
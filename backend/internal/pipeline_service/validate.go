@@ -0,0 +1,380 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"fmt"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single problem found in a pipeline. NodeID / EdgeID / Param point
+// the editor at what to highlight.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	NodeID   string   `json:"nodeId,omitempty"`
+	EdgeID   string   `json:"edgeId,omitempty"`
+	Param    string   `json:"param,omitempty"`
+}
+
+// HasErrors reports whether any diagnostic would stop the pipeline from running
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a pipeline graph and returns every problem it finds. An empty
+// result means cv.exe can run it as-is.
+func Validate(pipeline models.PipelineData) []Diagnostic {
+	diags := []Diagnostic{}
+
+	nodes := map[string]*models.PipelineNode{}
+	for i := range pipeline.Nodes {
+		node := &pipeline.Nodes[i]
+
+		if node.ID == "" {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "missing_node_id",
+				Message: fmt.Sprintf("Node at index %d has no id", i),
+			})
+			continue
+		}
+		if _, dup := nodes[node.ID]; dup {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "duplicate_node_id", NodeID: node.ID,
+				Message: fmt.Sprintf("Node id %q is used more than once", node.ID),
+			})
+			continue
+		}
+		nodes[node.ID] = node
+
+		diags = append(diags, validateNode(node)...)
+	}
+
+	// edges
+	outgoing := map[string][]string{}
+	incoming := map[string][]string{}
+	for i, edge := range pipeline.Edges {
+		edgeID := edge.ID
+		if edgeID == "" {
+			edgeID = fmt.Sprintf("#%d", i)
+		}
+
+		source, sourceOk := nodes[edge.Source]
+		target, targetOk := nodes[edge.Target]
+		if !sourceOk {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "dangling_edge", EdgeID: edgeID,
+				Message: fmt.Sprintf("Edge source %q does not exist", edge.Source),
+			})
+		}
+		if !targetOk {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "dangling_edge", EdgeID: edgeID,
+				Message: fmt.Sprintf("Edge target %q does not exist", edge.Target),
+			})
+		}
+		if !sourceOk || !targetOk {
+			continue
+		}
+
+		if def, ok := LookupNode(source.Data.CvNodeType); ok && def.Outputs == 0 {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "invalid_edge", EdgeID: edgeID, NodeID: source.ID,
+				Message: fmt.Sprintf("%s nodes have no outputs", def.DisplayName),
+			})
+		}
+		if def, ok := LookupNode(target.Data.CvNodeType); ok && def.Inputs == 0 {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "invalid_edge", EdgeID: edgeID, NodeID: target.ID,
+				Message: fmt.Sprintf("%s nodes have no inputs", def.DisplayName),
+			})
+		}
+
+		outgoing[edge.Source] = append(outgoing[edge.Source], edge.Target)
+		incoming[edge.Target] = append(incoming[edge.Target], edge.Source)
+	}
+
+	// fan-in, cv.exe only feeds a node as many images as it has inputs
+	for _, node := range pipeline.Nodes {
+		if _, ok := nodes[node.ID]; !ok {
+			continue
+		}
+		def, ok := LookupNode(node.Data.CvNodeType)
+		if !ok || def.Inputs == 0 || len(incoming[node.ID]) <= def.Inputs {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError, Code: "too_many_inputs", NodeID: node.ID,
+			Message: fmt.Sprintf("Node %q has %d incoming edges, %s nodes take at most %d", nodeLabel(&node), len(incoming[node.ID]), def.DisplayName, def.Inputs),
+		})
+	}
+
+	// required node types
+	var sources, outputs []string
+	for _, node := range pipeline.Nodes {
+		if _, ok := nodes[node.ID]; !ok {
+			continue
+		}
+		switch node.Data.CvNodeType {
+		case models.CvNodeSource:
+			sources = append(sources, node.ID)
+		case models.CvNodeOutput:
+			outputs = append(outputs, node.ID)
+		}
+	}
+	if len(sources) == 0 {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError, Code: "missing_source",
+			Message: "Pipeline has no Source node",
+		})
+	}
+	// cv.exe starts from whichever node has no incoming edges, so there can only be one
+	for _, id := range sources[min(len(sources), 1):] {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError, Code: "multiple_sources", NodeID: id,
+			Message: fmt.Sprintf("Node %q is a second Source node, a pipeline can only have one", nodeLabel(nodes[id])),
+		})
+	}
+	if len(outputs) == 0 {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError, Code: "missing_output",
+			Message: "Pipeline has no Output node",
+		})
+	}
+
+	diags = append(diags, findCycles(pipeline.Nodes, nodes, outgoing)...)
+
+	// unreachable nodes, which cv.exe could mistake for the start of the pipeline
+	reached := map[string]bool{}
+	stack := append([]string{}, sources...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reached[id] {
+			continue
+		}
+		reached[id] = true
+		stack = append(stack, outgoing[id]...)
+	}
+	if len(sources) > 0 {
+		for _, node := range pipeline.Nodes {
+			if _, ok := nodes[node.ID]; !ok || reached[node.ID] {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "unreachable_node", NodeID: node.ID,
+				Message: fmt.Sprintf("Node %q is not reachable from a Source node", nodeLabel(&node)),
+			})
+		}
+	}
+
+	// dead ends, nodes whose images never make it to an Output so their work is wasted
+	leadsToOutput := map[string]bool{}
+	stack = append(stack[:0], outputs...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if leadsToOutput[id] {
+			continue
+		}
+		leadsToOutput[id] = true
+		stack = append(stack, incoming[id]...)
+	}
+	if len(outputs) > 0 {
+		for _, node := range pipeline.Nodes {
+			// unreachable nodes are already errors
+			if _, ok := nodes[node.ID]; !ok || leadsToOutput[node.ID] || (len(sources) > 0 && !reached[node.ID]) {
+				continue
+			}
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning, Code: "dead_end_node", NodeID: node.ID,
+				Message: fmt.Sprintf("Node %q does not lead to an Output node", nodeLabel(&node)),
+			})
+		}
+	}
+
+	return diags
+}
+
+func validateNode(node *models.PipelineNode) []Diagnostic {
+	var diags []Diagnostic
+
+	if node.Data.CvNodeType == "" {
+		return append(diags, Diagnostic{
+			Severity: SeverityError, Code: "missing_node_type", NodeID: node.ID,
+			Message: fmt.Sprintf("Node %q has no type", nodeLabel(node)),
+		})
+	}
+	def, ok := LookupNode(node.Data.CvNodeType)
+	if !ok {
+		return append(diags, Diagnostic{
+			Severity: SeverityError, Code: "unknown_node_type", NodeID: node.ID,
+			Message: fmt.Sprintf("Node %q has unknown type %q", nodeLabel(node), node.Data.CvNodeType),
+		})
+	}
+
+	for _, param := range def.Params {
+		name := param.Key
+		value, present := node.Data.Params[name]
+		if !present {
+			if param.Required {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError, Code: "missing_param", NodeID: node.ID, Param: name,
+					Message: fmt.Sprintf("Node %q is missing param %q", nodeLabel(node), name),
+				})
+			}
+			continue
+		}
+
+		var number float64
+		switch param.Kind {
+		case ParamInt:
+			i, ok := value.Int()
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError, Code: "invalid_param", NodeID: node.ID, Param: name,
+					Message: fmt.Sprintf("Param %q of node %q must be an integer", name, nodeLabel(node)),
+				})
+				continue
+			}
+			number = float64(i)
+		case ParamNumber:
+			f, ok := value.Float()
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError, Code: "invalid_param", NodeID: node.ID, Param: name,
+					Message: fmt.Sprintf("Param %q of node %q must be a number", name, nodeLabel(node)),
+				})
+				continue
+			}
+			number = f
+		case ParamBool:
+			if _, ok := value.Bool(); !ok {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError, Code: "invalid_param", NodeID: node.ID, Param: name,
+					Message: fmt.Sprintf("Param %q of node %q must be true or false", name, nodeLabel(node)),
+				})
+				continue
+			}
+		}
+
+		if len(param.Options) > 0 && !isOption(param, value) {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "invalid_param", NodeID: node.ID, Param: name,
+				Message: fmt.Sprintf("Param %q of node %q is not one of its options", name, nodeLabel(node)),
+			})
+			continue
+		}
+		if (param.Min != nil && number < *param.Min) || (param.Max != nil && number > *param.Max) {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "param_out_of_range", NodeID: node.ID, Param: name,
+				Message: fmt.Sprintf("Param %q of node %q is out of range (%s)", name, nodeLabel(node), rangeText(param)),
+			})
+		}
+	}
+
+	return diags
+}
+
+// findCycles reports every node that sits on a cycle, using an iterative DFS
+func findCycles(order []models.PipelineNode, nodes map[string]*models.PipelineNode, outgoing map[string][]string) []Diagnostic {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	var diags []Diagnostic
+	state := map[string]int{}
+	onCycle := map[string]bool{}
+
+	type frame struct {
+		id   string
+		next int
+	}
+
+	for _, root := range order {
+		if _, ok := nodes[root.ID]; !ok || state[root.ID] != unvisited {
+			continue
+		}
+
+		path := []frame{{id: root.ID}}
+		state[root.ID] = visiting
+		for len(path) > 0 {
+			top := &path[len(path)-1]
+			targets := outgoing[top.id]
+			if top.next >= len(targets) {
+				state[top.id] = done
+				path = path[:len(path)-1]
+				continue
+			}
+
+			target := targets[top.next]
+			top.next++
+
+			switch state[target] {
+			case unvisited:
+				state[target] = visiting
+				path = append(path, frame{id: target})
+			case visiting:
+				// everything on the path from target to top is part of the cycle
+				for i := len(path) - 1; i >= 0; i-- {
+					onCycle[path[i].id] = true
+					if path[i].id == target {
+						break
+					}
+				}
+			}
+		}
+	}
+
+	for _, node := range order {
+		if onCycle[node.ID] {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError, Code: "cycle", NodeID: node.ID,
+				Message: fmt.Sprintf("Node %q is part of a cycle", nodeLabel(&node)),
+			})
+			delete(onCycle, node.ID)
+		}
+	}
+
+	return diags
+}
+
+func nodeLabel(node *models.PipelineNode) string {
+	if node.Data.Name != "" {
+		return node.Data.Name
+	}
+	return node.ID
+}
+
+func rangeText(param ParamDefinition) string {
+	switch {
+	case param.Min != nil && param.Max != nil:
+		return fmt.Sprintf("%g to %g", *param.Min, *param.Max)
+	case param.Min != nil:
+		return fmt.Sprintf(">= %g", *param.Min)
+	default:
+		return fmt.Sprintf("<= %g", *param.Max)
+	}
+}
+
+func isOption(param ParamDefinition, value models.ParamValue) bool {
+	for _, option := range param.Options {
+		if sameParamValue(option, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package pipeline_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+// pipelineFrom decodes a test pipeline, failing the test on bad JSON
+func pipelineFrom(t *testing.T, data string) models.PipelineData {
+	t.Helper()
+	var pipeline models.PipelineData
+	if err := json.Unmarshal([]byte(data), &pipeline); err != nil {
+		t.Fatalf("bad test pipeline: %v", err)
+	}
+	return pipeline
+}
+
+func diagnosticCodes(diags []Diagnostic) []string {
+	codes := make([]string, len(diags))
+	for i, d := range diags {
+		codes[i] = d.Code
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+		want     []string
+	}{
+		{
+			name: "valid",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"b","data":{"cvNodeType":"blur","params":{"size":3}}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`,
+			want: []string{},
+		},
+		{
+			name: "cycle",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"a","data":{"cvNodeType":"deepfry"}},
+				{"id":"b","data":{"cvNodeType":"deepfry"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"a"},{"source":"a","target":"b"},{"source":"b","target":"a"},{"source":"b","target":"o"}]}`,
+			want: []string{"cycle", "cycle", "too_many_inputs"},
+		},
+		{
+			name: "dangling edge",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"id":"e1","source":"s","target":"o"},{"id":"e2","source":"s","target":"gone"},{"id":"e3","source":"gone","target":"o"}]}`,
+			want: []string{"dangling_edge", "dangling_edge"},
+		},
+		{
+			name: "param below min",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"b","data":{"cvNodeType":"blur","params":{"size":0}}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`,
+			want: []string{"param_out_of_range"},
+		},
+		{
+			name: "param wrong type and missing",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"b1","data":{"cvNodeType":"blur","params":{"size":2.5}}},
+				{"id":"b2","data":{"cvNodeType":"blur","params":{}}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"b1"},{"source":"b1","target":"b2"},{"source":"b2","target":"o"}]}`,
+			want: []string{"invalid_param", "missing_param"},
+		},
+		{
+			name: "disconnected node",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"stray","data":{"cvNodeType":"deepfry"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"o"}]}`,
+			want: []string{"unreachable_node"},
+		},
+		{
+			name: "two sources",
+			pipeline: `{"nodes":[
+				{"id":"s1","data":{"cvNodeType":"source"}},
+				{"id":"s2","data":{"cvNodeType":"source"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s1","target":"o"},{"source":"s2","target":"o"}]}`,
+			want: []string{"multiple_sources", "too_many_inputs"},
+		},
+		{
+			name: "fan-in",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"a","data":{"cvNodeType":"deepfry"}},
+				{"id":"b","data":{"cvNodeType":"deepfry"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"a"},{"source":"s","target":"b"},{"source":"a","target":"o"},{"source":"b","target":"o"}]}`,
+			want: []string{"too_many_inputs"},
+		},
+		{
+			name: "dead end branch",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"a","data":{"cvNodeType":"deepfry"}},
+				{"id":"b","data":{"cvNodeType":"deepfry"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"a"},{"source":"s","target":"b"},{"source":"a","target":"o"}]}`,
+			want: []string{"dead_end_node"},
+		},
+		{
+			name: "chain that stops short",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"a","data":{"cvNodeType":"deepfry"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"a"}]}`,
+			want: []string{"dead_end_node", "dead_end_node", "unreachable_node"},
+		},
+		{
+			name: "missing and unknown types",
+			pipeline: `{"nodes":[
+				{"id":"s","data":{"cvNodeType":"source"}},
+				{"id":"x","data":{"name":"untyped"}},
+				{"id":"y","data":{"cvNodeType":"sharpen"}},
+				{"id":"o","data":{"cvNodeType":"output"}}],
+				"edges":[{"source":"s","target":"x"},{"source":"x","target":"y"},{"source":"y","target":"o"}]}`,
+			want: []string{"missing_node_type", "unknown_node_type"},
+		},
+		{
+			name:     "empty",
+			pipeline: `{"nodes":[],"edges":[]}`,
+			want:     []string{"missing_output", "missing_source"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diags := Validate(pipelineFrom(t, test.pipeline))
+			got := diagnosticCodes(diags)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v (%+v)", got, test.want, diags)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got %v, want %v (%+v)", got, test.want, diags)
+				}
+			}
+			wantErrors := false
+			for _, code := range test.want {
+				wantErrors = wantErrors || code != "dead_end_node"
+			}
+			if HasErrors(diags) != wantErrors {
+				t.Errorf("HasErrors = %v with %v", HasErrors(diags), got)
+			}
+		})
+	}
+}
+
+func TestValidateDeadEndIsWarning(t *testing.T) {
+	diags := Validate(pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"cvNodeType":"source"}},
+		{"id":"b","data":{"cvNodeType":"blur","params":{"size":3}}},
+		{"id":"d","data":{"name":"Unused","cvNodeType":"deepfry"}},
+		{"id":"o","data":{"cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"},{"source":"b","target":"d"}]}`))
+
+	if len(diags) != 1 || diags[0].Code != "dead_end_node" {
+		t.Fatalf("got %+v, want one dead_end_node", diags)
+	}
+	if diags[0].Severity != SeverityWarning || diags[0].NodeID != "d" {
+		t.Errorf("dead end is a %s on node %q, want a warning on d", diags[0].Severity, diags[0].NodeID)
+	}
+}
+
+func TestValidateReportsOffendingNode(t *testing.T) {
+	diags := Validate(pipelineFrom(t, `{"nodes":[
+		{"id":"s","data":{"cvNodeType":"source"}},
+		{"id":"b","data":{"name":"My blur","cvNodeType":"blur","params":{"size":-1}}},
+		{"id":"o","data":{"cvNodeType":"output"}}],
+		"edges":[{"source":"s","target":"b"},{"source":"b","target":"o"}]}`))
+
+	if len(diags) != 1 {
+		t.Fatalf("got %+v, want one diagnostic", diags)
+	}
+	if diags[0].NodeID != "b" || diags[0].Param != "size" {
+		t.Errorf("diagnostic points at node %q param %q, want b size", diags[0].NodeID, diags[0].Param)
+	}
+}
@@ -0,0 +1,105 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Access to a project comes from being its creator, who is always an owner, or from a
+// row in project_members. Every handler that touches a project goes through Authorize.
+
+var (
+	// ErrProjectNotFound is also returned when the user has no access at all, so
+	// project IDs can't be probed
+	ErrProjectNotFound = errors.New("project not found")
+	ErrForbidden       = errors.New("insufficient project role")
+)
+
+// Authorize loads a project and checks the user holds at least the required role on it.
+// Pass an Unscoped db to reach projects in the trash.
+func Authorize(db *gorm.DB, projectID uint, userID uint, required models.ProjectRole) (*models.Project, models.ProjectRole, error) {
+	var project models.Project
+	if err := db.Where("id = ?", projectID).First(&project).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrProjectNotFound
+		}
+		return nil, "", err
+	}
+
+	role, err := RoleFor(db, &project, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		return nil, "", ErrProjectNotFound
+	}
+	if !role.Allows(required) {
+		return &project, role, ErrForbidden
+	}
+	return &project, role, nil
+}
+
+// RoleFor returns the user's role on a project, or "" if they have none
+func RoleFor(db *gorm.DB, project *models.Project, userID uint) (models.ProjectRole, error) {
+	if project.CreatorID == userID {
+		return models.RoleOwner, nil
+	}
+
+	var member models.ProjectMember
+	err := db.Session(&gorm.Session{NewDB: true}).
+		Where("project_id = ? AND user_id = ?", project.ID, userID).
+		Limit(1).
+		Find(&member).Error
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// AccessibleBy scopes a project query to the projects the user has any role on
+func AccessibleBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		memberOf := db.Session(&gorm.Session{NewDB: true}).Model(&models.ProjectMember{}).
+			Select("project_id").
+			Where("user_id = ?", userID)
+		return db.Where("creator_id = ? OR id IN (?)", userID, memberOf)
+	}
+}
+
+// OwnedBy scopes a project query to the projects the user is an owner of
+func OwnedBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		ownerOf := db.Session(&gorm.Session{NewDB: true}).Model(&models.ProjectMember{}).
+			Select("project_id").
+			Where("user_id = ? AND role = ?", userID, models.RoleOwner)
+		return db.Where("creator_id = ? OR id IN (?)", userID, ownerOf)
+	}
+}
+
+// RolesFor looks up the user's role on each of the given projects at once
+func RolesFor(db *gorm.DB, projects []models.Project, userID uint) (map[uint]models.ProjectRole, error) {
+	roles := make(map[uint]models.ProjectRole, len(projects))
+	var memberIDs []uint
+	for _, project := range projects {
+		if project.CreatorID == userID {
+			roles[project.ID] = models.RoleOwner
+		} else {
+			memberIDs = append(memberIDs, project.ID)
+		}
+	}
+	if len(memberIDs) == 0 {
+		return roles, nil
+	}
+
+	var members []models.ProjectMember
+	err := db.Where("user_id = ? AND project_id IN ?", userID, memberIDs).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		roles[member.ProjectID] = member.Role
+	}
+	return roles, nil
+}
@@ -0,0 +1,161 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain runs the package against an in-memory database
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to open test database: ", err)
+	}
+	// every connection to :memory: is its own database
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Tag{},
+		&models.Project{},
+		&models.ProjectVersion{},
+		&models.ProjectMember{},
+		&models.ProjectSample{},
+		&models.ShareLink{},
+		&models.Folder{},
+		&models.FolderProject{},
+	)
+	if err != nil {
+		log.Fatal("Failed to migrate test database: ", err)
+	}
+	initializers.DB = db
+
+	os.Exit(m.Run())
+}
+
+// nextUserID hands out user IDs, so tests don't see each other's projects
+var nextUserID uint = 1000
+
+func newUserID() uint {
+	nextUserID++
+	return nextUserID
+}
+
+func createProject(t *testing.T, creatorID uint, title string) *models.Project {
+	t.Helper()
+	project := &models.Project{CreatorID: creatorID, Title: title, Data: []byte(`{"nodes":[],"edges":[]}`)}
+	if err := initializers.DB.Create(project).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	return project
+}
+
+func addMember(t *testing.T, project *models.Project, userID uint, role models.ProjectRole) {
+	t.Helper()
+	member := models.ProjectMember{ProjectID: project.ID, UserID: userID, Role: role}
+	if err := initializers.DB.Create(&member).Error; err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	creator, editor, viewer, stranger := newUserID(), newUserID(), newUserID(), newUserID()
+	project := createProject(t, creator, "Shared")
+	addMember(t, project, editor, models.RoleEditor)
+	addMember(t, project, viewer, models.RoleViewer)
+
+	tests := []struct {
+		name     string
+		userID   uint
+		required models.ProjectRole
+		role     models.ProjectRole
+		err      error
+	}{
+		{"creator is an owner", creator, models.RoleOwner, models.RoleOwner, nil},
+		{"editor can edit", editor, models.RoleEditor, models.RoleEditor, nil},
+		{"editor can view", editor, models.RoleViewer, models.RoleEditor, nil},
+		{"editor can't manage", editor, models.RoleOwner, models.RoleEditor, ErrForbidden},
+		{"viewer can view", viewer, models.RoleViewer, models.RoleViewer, nil},
+		{"viewer can't edit", viewer, models.RoleEditor, models.RoleViewer, ErrForbidden},
+		{"stranger can't tell it exists", stranger, models.RoleViewer, "", ErrProjectNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, role, err := Authorize(initializers.DB, project.ID, tt.userID, tt.required)
+			if !errors.Is(err, tt.err) || role != tt.role {
+				t.Fatalf("Authorize = %q, %v, want %q, %v", role, err, tt.role, tt.err)
+			}
+			if tt.err == nil && (found == nil || found.ID != project.ID) {
+				t.Fatalf("Authorize returned project %+v", found)
+			}
+		})
+	}
+
+	if _, _, err := Authorize(initializers.DB, project.ID+1000, creator, models.RoleViewer); !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("Authorize of a missing project = %v, want ErrProjectNotFound", err)
+	}
+}
+
+func TestAuthorizeTrashed(t *testing.T) {
+	creator := newUserID()
+	project := createProject(t, creator, "Trashed")
+	if err := initializers.DB.Delete(project).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Authorize(initializers.DB, project.ID, creator, models.RoleOwner); !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("Authorize of a trashed project = %v, want ErrProjectNotFound", err)
+	}
+	found, _, err := Authorize(initializers.DB.Unscoped(), project.ID, creator, models.RoleOwner)
+	if err != nil || !found.DeletedAt.Valid {
+		t.Fatalf("Unscoped Authorize = %+v, %v, want the trashed project", found, err)
+	}
+}
+
+func TestAccessibleAndOwnedBy(t *testing.T) {
+	user, other := newUserID(), newUserID()
+	own := createProject(t, user, "Own")
+	owned := createProject(t, other, "Co-owned")
+	addMember(t, owned, user, models.RoleOwner)
+	edited := createProject(t, other, "Edited")
+	addMember(t, edited, user, models.RoleEditor)
+	createProject(t, other, "Private")
+
+	var accessible, ownedIDs []uint
+	initializers.DB.Model(&models.Project{}).Scopes(AccessibleBy(user)).Order("id").Pluck("id", &accessible)
+	initializers.DB.Model(&models.Project{}).Scopes(OwnedBy(user)).Order("id").Pluck("id", &ownedIDs)
+
+	assertIDs(t, "accessible", accessible, own.ID, owned.ID, edited.ID)
+	assertIDs(t, "owned", ownedIDs, own.ID, owned.ID)
+
+	roles, err := RolesFor(initializers.DB, []models.Project{*own, *owned, *edited}, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles[own.ID] != models.RoleOwner || roles[owned.ID] != models.RoleOwner || roles[edited.ID] != models.RoleEditor {
+		t.Fatalf("roles = %v", roles)
+	}
+}
+
+func assertIDs(t *testing.T, what string, got []uint, want ...uint) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package project_service
+
+import (
+	"bytes"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/pipeline_service"
+	"edward-lemonade/chive/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Projects move between accounts and deployments as .chive archives, zips holding a
+// manifest with the pipeline and metadata plus optional sample images. SchemaVersion is
+// bumped whenever the manifest changes shape, and ReadArchive accepts every version up
+// to the current one.
+
+const (
+	ArchiveFormat        = "chive-project"
+	ArchiveSchemaVersion = 1
+	ArchiveExtension     = ".chive"
+	// the manifest plus every sample a project can have
+	MaxArchiveSize = MaxSamplesPerProject*MaxSampleSize + 8<<20
+
+	archiveManifestName = "manifest.json"
+	archiveSamplesDir   = "samples/"
+)
+
+var ErrInvalidArchive = errors.New("invalid project archive")
+
+// BuildArchive packs a project, its tags and the given samples into a .chive archive
+func BuildArchive(project *models.Project, exportedBy string, samples []models.ProjectSample) (*bytes.Buffer, error) {
+	manifest := models.ProjectArchiveManifest{
+		Format:        ArchiveFormat,
+		SchemaVersion: ArchiveSchemaVersion,
+		ExportedAt:    time.Now().Format("2006-01-02T15:04:05Z07:00"),
+		ExportedBy:    exportedBy,
+		Project: models.ProjectArchiveMetadata{
+			Title:           project.Title,
+			Description:     project.Description,
+			Tags:            TagNames(project.Tags),
+			CreatorUsername: project.CreatorUsername,
+			CreatedAt:       project.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			UpdatedAt:       project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		},
+		Samples: make([]models.ProjectArchiveSample, len(samples)),
+	}
+	data, err := pipeline_service.DecodePipeline(project.Data)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Data = data
+
+	entries := make([]utils.ZipEntry, 0, len(samples)+1)
+	for i, sample := range samples {
+		manifest.Samples[i] = models.ProjectArchiveSample{Name: sample.Name, ContentType: sample.ContentType}
+		entries = append(entries, utils.ZipEntry{Name: archiveSamplesDir + sample.Name, Data: sample.Data})
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	entries = append([]utils.ZipEntry{{Name: archiveManifestName, Data: manifestBytes}}, entries...)
+
+	return utils.CreateZip(entries)
+}
+
+// ReadArchive unpacks and checks a .chive archive, returning its manifest and samples.
+// Every problem with the archive itself is reported as ErrInvalidArchive.
+func ReadArchive(data []byte) (*models.ProjectArchiveManifest, []models.ProjectSample, error) {
+	files, err := utils.ReadZip(data, MaxArchiveSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	manifestBytes, ok := files[archiveManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, archiveManifestName)
+	}
+	// the pipeline is read raw so pipelines from older servers can be migrated first
+	type manifestFields models.ProjectArchiveManifest
+	var doc struct {
+		manifestFields
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(manifestBytes, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s is not valid: %v", ErrInvalidArchive, archiveManifestName, err)
+	}
+	manifest := models.ProjectArchiveManifest(doc.manifestFields)
+	if manifest.Data, err = pipeline_service.DecodePipeline(doc.Data); err != nil {
+		return nil, nil, fmt.Errorf("%w: pipeline is not valid: %v", ErrInvalidArchive, err)
+	}
+	if manifest.Format != ArchiveFormat {
+		return nil, nil, fmt.Errorf("%w: not a Chive project", ErrInvalidArchive)
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > ArchiveSchemaVersion {
+		return nil, nil, fmt.Errorf("%w: schema version %d is not supported, this server reads up to %d", ErrInvalidArchive, manifest.SchemaVersion, ArchiveSchemaVersion)
+	}
+	if strings.TrimSpace(manifest.Project.Title) == "" {
+		return nil, nil, fmt.Errorf("%w: project title is missing", ErrInvalidArchive)
+	}
+
+	if len(manifest.Samples) > MaxSamplesPerProject {
+		return nil, nil, fmt.Errorf("%w: more than %d samples", ErrInvalidArchive, MaxSamplesPerProject)
+	}
+	samples := make([]models.ProjectSample, 0, len(manifest.Samples))
+	seen := map[string]bool{}
+	for _, entry := range manifest.Samples {
+		contents, ok := files[archiveSamplesDir+entry.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: sample %q is missing", ErrInvalidArchive, entry.Name)
+		}
+		name, contentType, err := CheckSample(entry.Name, contents)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if name != entry.Name || seen[name] {
+			return nil, nil, fmt.Errorf("%w: bad sample name %q", ErrInvalidArchive, entry.Name)
+		}
+		seen[name] = true
+		samples = append(samples, models.ProjectSample{
+			Name:        name,
+			ContentType: contentType,
+			Size:        len(contents),
+			Data:        contents,
+		})
+	}
+
+	return &manifest, samples, nil
+}
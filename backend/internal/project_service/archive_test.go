@@ -0,0 +1,147 @@
+package project_service
+
+import (
+	"bytes"
+	"edward-lemonade/chive/internal/models"
+	"edward-lemonade/chive/internal/utils"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var samplePNG = []byte("\x89PNG\r\n\x1a\nnot really the rest of a png")
+
+// archiveOf zips a manifest and files the way a client could, bypassing BuildArchive
+func archiveOf(t *testing.T, manifest interface{}, files map[string][]byte) []byte {
+	t.Helper()
+	var entries []utils.ZipEntry
+	if manifest != nil {
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, utils.ZipEntry{Name: archiveManifestName, Data: data})
+	}
+	for name, data := range files {
+		entries = append(entries, utils.ZipEntry{Name: name, Data: data})
+	}
+	buf, err := utils.CreateZip(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testManifest(samples ...string) models.ProjectArchiveManifest {
+	manifest := models.ProjectArchiveManifest{
+		Format:        ArchiveFormat,
+		SchemaVersion: ArchiveSchemaVersion,
+		Project:       models.ProjectArchiveMetadata{Title: "Imported"},
+	}
+	for _, name := range samples {
+		manifest.Samples = append(manifest.Samples, models.ProjectArchiveSample{Name: name})
+	}
+	return manifest
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	project := &models.Project{
+		Title:           "Edges",
+		Description:     "finds edges",
+		CreatorUsername: "maker",
+		Tags:            []models.Tag{{Name: "edge"}, {Name: "demo"}},
+		Data:            []byte(`{"nodes":[{"id":"s","type":"source","position":{"x":0,"y":0},"data":{"name":"Source","cvNodeType":"source"}}],"edges":[]}`),
+	}
+	samples := []models.ProjectSample{{Name: "a.png", ContentType: "image/png", Data: samplePNG}}
+
+	buf, err := BuildArchive(project, "exporter", samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, read, err := ReadArchive(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Format != ArchiveFormat || manifest.SchemaVersion != ArchiveSchemaVersion || manifest.ExportedBy != "exporter" {
+		t.Fatalf("manifest header = %+v", manifest)
+	}
+	meta := manifest.Project
+	if meta.Title != "Edges" || meta.Description != "finds edges" || meta.CreatorUsername != "maker" {
+		t.Fatalf("project metadata = %+v", meta)
+	}
+	if len(meta.Tags) != 2 || meta.Tags[0] != "edge" || meta.Tags[1] != "demo" {
+		t.Fatalf("tags = %v", meta.Tags)
+	}
+	if len(manifest.Data.Nodes) != 1 || manifest.Data.Nodes[0].ID != "s" {
+		t.Fatalf("pipeline = %+v", manifest.Data)
+	}
+	if len(read) != 1 || read[0].Name != "a.png" || read[0].ContentType != "image/png" ||
+		read[0].Size != len(samplePNG) || !bytes.Equal(read[0].Data, samplePNG) {
+		t.Fatalf("samples = %+v", read)
+	}
+}
+
+func TestReadArchiveMinimal(t *testing.T) {
+	manifest, samples, err := ReadArchive(archiveOf(t, testManifest("a.png"), map[string][]byte{"samples/a.png": samplePNG}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Project.Title != "Imported" || len(samples) != 1 || samples[0].Name != "a.png" {
+		t.Fatalf("ReadArchive = %+v, %+v", manifest, samples)
+	}
+}
+
+func TestReadArchiveInvalid(t *testing.T) {
+	oversized := append(append([]byte{}, samplePNG...), make([]byte, MaxSampleSize)...)
+	tooMany := make([]string, MaxSamplesPerProject+1)
+	tooManyFiles := map[string][]byte{}
+	for i := range tooMany {
+		tooMany[i] = string(rune('a'+i)) + ".png"
+		tooManyFiles[archiveSamplesDir+tooMany[i]] = samplePNG
+	}
+	with := func(change func(*models.ProjectArchiveManifest)) models.ProjectArchiveManifest {
+		manifest := testManifest()
+		change(&manifest)
+		return manifest
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		reason  string
+	}{
+		{"not a zip", []byte("PK but not really"), "zip"},
+		{"missing manifest", archiveOf(t, nil, map[string][]byte{"project.json": []byte(`{}`)}), "manifest.json is missing"},
+		{"manifest not JSON", archiveOf(t, nil, map[string][]byte{archiveManifestName: []byte("format: chive-project")}), "manifest.json is not valid"},
+		{"pipeline not valid", archiveOf(t, map[string]interface{}{
+			"format": ArchiveFormat, "schemaVersion": 1, "project": map[string]interface{}{"title": "x"}, "data": "nodes",
+		}, nil), "pipeline is not valid"},
+		{"wrong format", archiveOf(t, with(func(m *models.ProjectArchiveManifest) { m.Format = "zip" }), nil), "not a Chive project"},
+		{"no schema version", archiveOf(t, with(func(m *models.ProjectArchiveManifest) { m.SchemaVersion = 0 }), nil), "schema version 0"},
+		{"negative schema version", archiveOf(t, with(func(m *models.ProjectArchiveManifest) { m.SchemaVersion = -1 }), nil), "schema version -1"},
+		{"newer schema version", archiveOf(t, with(func(m *models.ProjectArchiveManifest) { m.SchemaVersion = ArchiveSchemaVersion + 1 }), nil), "schema version 2"},
+		{"no title", archiveOf(t, with(func(m *models.ProjectArchiveManifest) { m.Project.Title = "  " }), nil), "title is missing"},
+		{"missing sample", archiveOf(t, testManifest("a.png"), nil), "sample \"a.png\" is missing"},
+		{"oversized sample", archiveOf(t, testManifest("a.png"), map[string][]byte{"samples/a.png": oversized}), "is over 10 MB"},
+		{"sample not an image", archiveOf(t, testManifest("a.png"), map[string][]byte{"samples/a.png": []byte("#!/bin/sh\n")}), "not an image"},
+		{"empty sample", archiveOf(t, testManifest("a.png"), map[string][]byte{"samples/a.png": {}}), "is empty"},
+		{"too many samples", archiveOf(t, testManifest(tooMany...), tooManyFiles), "more than 20 samples"},
+		{"duplicate sample", archiveOf(t, testManifest("a.png", "a.png"), map[string][]byte{"samples/a.png": samplePNG}), "bad sample name \"a.png\""},
+		{"parent directory", archiveOf(t, testManifest("../a.png"), map[string][]byte{"samples/../a.png": samplePNG}), "bad sample name"},
+		{"nested traversal", archiveOf(t, testManifest("x/../../a.png"), map[string][]byte{"samples/x/../../a.png": samplePNG}), "bad sample name"},
+		{"absolute path", archiveOf(t, testManifest("/etc/a.png"), map[string][]byte{"samples//etc/a.png": samplePNG}), "bad sample name"},
+		{"subdirectory", archiveOf(t, testManifest("x/a.png"), map[string][]byte{"samples/x/a.png": samplePNG}), "bad sample name"},
+		{"backslashes", archiveOf(t, testManifest(`..\a.png`), map[string][]byte{`samples/..\a.png`: samplePNG}), "bad sample name"},
+		{"dot dot", archiveOf(t, testManifest(".."), map[string][]byte{"samples/..": samplePNG}), "missing file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, samples, err := ReadArchive(tt.archive)
+			if !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("ReadArchive = %+v, %d samples, %v, want ErrInvalidArchive for %q", manifest, len(samples), err, tt.reason)
+			}
+		})
+	}
+}
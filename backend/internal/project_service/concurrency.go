@@ -0,0 +1,65 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Saves carry the version (or failing that the updatedAt) the editor last loaded. If the
+// project has moved on since, the save is stale and gets rejected instead of silently
+// overwriting someone else's work.
+
+// ErrStaleSave is returned by LockForSave when the project changed after the client loaded it
+var ErrStaleSave = errors.New("project was changed since it was loaded")
+
+// LockForSave locks the project row for the rest of tx and checks the client's base
+// against it, returning the current row and latest version number either way. A zero
+// baseVersion falls back to comparing baseUpdatedAt, and with neither the save is
+// allowed through but logged. Saves that rename the project record a version too, see
+// RecordRename, so clients should send baseVersion.
+func LockForSave(tx *gorm.DB, projectID uint, baseVersion int, baseUpdatedAt string) (*models.Project, int, error) {
+	var current models.Project
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, projectID).Error; err != nil {
+		return nil, 0, err
+	}
+
+	latest, err := LatestVersion(tx, projectID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case baseVersion != 0:
+		if baseVersion != latest {
+			return &current, latest, ErrStaleSave
+		}
+	case baseUpdatedAt != "":
+		base, err := time.Parse("2006-01-02T15:04:05Z07:00", baseUpdatedAt)
+		if err != nil {
+			// can't prove the client is up to date, so send it the current copy
+			return &current, latest, ErrStaleSave
+		}
+		// timestamps go out to clients with second precision
+		if !current.UpdatedAt.Truncate(time.Second).Equal(base.Truncate(time.Second)) {
+			return &current, latest, ErrStaleSave
+		}
+	default:
+		log.Printf("Save of project %d has no base version, it is not checked for conflicts", projectID)
+	}
+	return &current, latest, nil
+}
+
+// LatestVersion returns the project's newest version number, 0 if it has none yet
+func LatestVersion(db *gorm.DB, projectID uint) (int, error) {
+	var latest int
+	err := db.Model(&models.ProjectVersion{}).
+		Where("project_id = ?", projectID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error
+	return latest, err
+}
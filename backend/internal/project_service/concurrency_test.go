@@ -0,0 +1,62 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLockForSave(t *testing.T) {
+	creator := newUserID()
+	project := createProject(t, creator, "Locked")
+	for i := 0; i < 2; i++ {
+		project.Data = []byte(fmt.Sprintf(`{"nodes":[],"edges":[],"n":%d}`, i))
+		if _, err := RecordVersion(initializers.DB, project, models.User{ID: creator}, "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updatedAt := project.UpdatedAt.Format("2006-01-02T15:04:05Z07:00")
+	earlier := project.UpdatedAt.Add(-time.Minute).Format("2006-01-02T15:04:05Z07:00")
+
+	tests := []struct {
+		name          string
+		baseVersion   int
+		baseUpdatedAt string
+		err           error
+	}{
+		{"latest version", 2, "", nil},
+		{"older version", 1, "", ErrStaleSave},
+		{"newer version", 3, "", ErrStaleSave},
+		{"version wins over updatedAt", 2, earlier, nil},
+		{"current updatedAt", 0, updatedAt, nil},
+		{"older updatedAt", 0, earlier, ErrStaleSave},
+		{"unparsable updatedAt", 0, "yesterday", ErrStaleSave},
+		{"no base", 0, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, latest, err := LockForSave(initializers.DB, project.ID, tt.baseVersion, tt.baseUpdatedAt)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("LockForSave = %v, want %v", err, tt.err)
+			}
+			// the current copy comes back either way, for the client to reload
+			if current == nil || current.ID != project.ID || latest != 2 {
+				t.Fatalf("LockForSave returned %+v at version %d", current, latest)
+			}
+		})
+	}
+
+	if _, _, err := LockForSave(initializers.DB, project.ID+1000, 1, ""); err == nil {
+		t.Fatal("LockForSave of a missing project succeeded")
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	project := createProject(t, newUserID(), "Unsaved")
+	if latest, err := LatestVersion(initializers.DB, project.ID); err != nil || latest != 0 {
+		t.Fatalf("LatestVersion of a project with no versions = %d, %v, want 0", latest, err)
+	}
+}
@@ -0,0 +1,133 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Folders belong to a user, and folder_projects files the projects they can access into
+// them. Nothing about a folder is visible to the other members of a shared project.
+
+const maxFolderNameLength = 64
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderExists   = errors.New("a folder with that name already exists")
+)
+
+// NormalizeFolderName trims a folder name and checks it isn't empty or too long
+func NormalizeFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("folder name is required")
+	}
+	if len(name) > maxFolderNameLength {
+		return "", fmt.Errorf("folder name is longer than %d characters", maxFolderNameLength)
+	}
+	return name, nil
+}
+
+// FindFolder loads one of the user's folders. Other users' folders are not found.
+func FindFolder(db *gorm.DB, userID uint, folderID uint) (*models.Folder, error) {
+	var folder models.Folder
+	err := db.Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFolderNotFound
+	}
+	return &folder, err
+}
+
+// CheckFolderName returns ErrFolderExists if the user has another folder with the name
+func CheckFolderName(db *gorm.DB, userID uint, name string, exceptID uint) error {
+	var count int64
+	err := db.Model(&models.Folder{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrFolderExists
+	}
+	return nil
+}
+
+// MoveToFolder files a project into one of the user's folders, replacing its current
+// folder. A nil folderID takes the project out of its folder.
+func MoveToFolder(db *gorm.DB, userID uint, projectID uint, folderID *uint) error {
+	if folderID == nil {
+		return db.Where("user_id = ? AND project_id = ?", userID, projectID).Delete(&models.FolderProject{}).Error
+	}
+
+	placement := models.FolderProject{UserID: userID, ProjectID: projectID, FolderID: *folderID}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"folder_id"}),
+	}).Create(&placement).Error
+}
+
+// FoldersFor looks up which of the user's folders each of the given projects is in.
+// Projects in no folder are left out.
+func FoldersFor(db *gorm.DB, projects []models.Project, userID uint) (map[uint]uint, error) {
+	folders := make(map[uint]uint, len(projects))
+	if len(projects) == 0 {
+		return folders, nil
+	}
+	projectIDs := make([]uint, len(projects))
+	for i, project := range projects {
+		projectIDs[i] = project.ID
+	}
+
+	var placements []models.FolderProject
+	err := db.Where("user_id = ? AND project_id IN ?", userID, projectIDs).Find(&placements).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, placement := range placements {
+		folders[placement.ProjectID] = placement.FolderID
+	}
+	return folders, nil
+}
+
+// FolderCounts counts the projects in each of the user's folders, leaving out projects
+// in the trash
+func FolderCounts(db *gorm.DB, userID uint) (map[uint]int, error) {
+	var rows []struct {
+		FolderID uint
+		Count    int
+	}
+	err := db.Model(&models.FolderProject{}).
+		Select("folder_projects.folder_id, COUNT(*) AS count").
+		Joins("JOIN projects ON projects.id = folder_projects.project_id AND projects.deleted_at IS NULL").
+		Where("folder_projects.user_id = ?", userID).
+		Group("folder_projects.folder_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.FolderID] = row.Count
+	}
+	return counts, nil
+}
+
+// InFolder scopes a project query to the projects the user filed into a folder. Folder
+// 0 means the projects the user hasn't filed anywhere.
+func InFolder(userID uint, folderID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		filed := db.Session(&gorm.Session{NewDB: true}).Model(&models.FolderProject{}).
+			Select("project_id").
+			Where("user_id = ?", userID)
+		if folderID == 0 {
+			return db.Where("id NOT IN (?)", filed)
+		}
+		return db.Where("id IN (?)", filed.Where("folder_id = ?", folderID))
+	}
+}
@@ -0,0 +1,28 @@
+package project_service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFolderName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"Work", "Work", false},
+		{"  Work in progress\t", "Work in progress", false},
+		{"", "", true},
+		{" \n ", "", true},
+		{strings.Repeat("f", maxFolderNameLength), strings.Repeat("f", maxFolderNameLength), false},
+		{strings.Repeat("f", maxFolderNameLength+1), "", true},
+		{"  " + strings.Repeat("f", maxFolderNameLength) + "  ", strings.Repeat("f", maxFolderNameLength), false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeFolderName(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeFolderName(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
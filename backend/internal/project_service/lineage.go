@@ -0,0 +1,98 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Duplicates and projects made from templates are forks: they record the parent project
+// and the parent's version they were copied from. Pulling merges whatever changed in the
+// parent since that version into the fork, then moves ParentVersion forward.
+
+const (
+	maxForkDepth    = 100
+	maxForkTreeSize = 500
+)
+
+// SetParent makes project a fork of parent at the parent's latest version. Call it before
+// creating the fork.
+func SetParent(db *gorm.DB, project *models.Project, parent *models.Project) error {
+	latest, err := LatestVersion(db, parent.ID)
+	if err != nil {
+		return err
+	}
+	parentID := parent.ID
+	project.ParentID = &parentID
+	project.ParentVersion = latest
+	return nil
+}
+
+// ForkRoot walks up from a project to its oldest ancestor that still exists
+func ForkRoot(db *gorm.DB, project *models.Project) (*models.Project, error) {
+	root := project
+	seen := map[uint]bool{project.ID: true}
+	for root.ParentID != nil && !seen[*root.ParentID] && len(seen) < maxForkDepth {
+		var parent models.Project
+		if err := db.Omit("Data").Where("id = ?", *root.ParentID).Limit(1).Find(&parent).Error; err != nil {
+			return nil, err
+		}
+		if parent.ID == 0 {
+			break
+		}
+		seen[parent.ID] = true
+		root = &parent
+	}
+	return root, nil
+}
+
+// ForkDescendants loads the forks of a project, their forks and so on, breadth first and
+// up to maxForkTreeSize projects
+func ForkDescendants(db *gorm.DB, rootID uint) ([]models.Project, error) {
+	var descendants []models.Project
+	seen := map[uint]bool{rootID: true}
+	frontier := []uint{rootID}
+	for len(frontier) > 0 && len(descendants) < maxForkTreeSize {
+		var forks []models.Project
+		err := db.Omit("Data").
+			Where("parent_id IN ?", frontier).
+			Order("id").
+			Limit(maxForkTreeSize - len(descendants)).
+			Find(&forks).Error
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for _, fork := range forks {
+			if seen[fork.ID] {
+				continue
+			}
+			seen[fork.ID] = true
+			descendants = append(descendants, fork)
+			frontier = append(frontier, fork.ID)
+		}
+	}
+	return descendants, nil
+}
+
+// UpstreamBase returns the pipeline a fork last synced with, the base of a pull. Forks
+// of projects that had no versions yet fall back to the fork's own first version,
+// which is the parent's pipeline as it was copied.
+func UpstreamBase(db *gorm.DB, fork *models.Project) (datatypes.JSON, error) {
+	if fork.ParentID != nil && fork.ParentVersion != 0 {
+		var version models.ProjectVersion
+		err := db.Where("project_id = ? AND version = ?", *fork.ParentID, fork.ParentVersion).Limit(1).Find(&version).Error
+		if err != nil {
+			return nil, err
+		}
+		if version.ID != 0 {
+			return version.Data, nil
+		}
+	}
+
+	var first models.ProjectVersion
+	err := db.Where("project_id = ?", fork.ID).Order("version").Limit(1).Find(&first).Error
+	return first.Data, err
+}
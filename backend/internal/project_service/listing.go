@@ -0,0 +1,190 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// The projects page pages through a user's projects with keyset pagination: each page
+// ends with a cursor holding the sort value and ID of its last project, and the next
+// page starts right after it. Unlike offsets this stays fast deep into the list and
+// doesn't skip or repeat projects when others are saved in between.
+
+const (
+	DefaultProjectPageSize = 50
+	MaxProjectPageSize     = 200
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or from a different sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type ProjectSort string
+
+const (
+	SortUpdated ProjectSort = "updated"
+	SortCreated ProjectSort = "created"
+	SortTitle   ProjectSort = "title"
+)
+
+func (s ProjectSort) Valid() bool {
+	return s == SortUpdated || s == SortCreated || s == SortTitle
+}
+
+// ProjectListQuery filters, sorts and pages a user's project list. Zero values mean no
+// filter.
+type ProjectListQuery struct {
+	Search        string   // words matched against titles, the last one as a prefix
+	Tags          []string // projects must have all of them, already normalized
+	Folder        *uint    // one of the user's folders, 0 for projects in no folder
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	Sort          ProjectSort
+	Ascending     bool
+	Limit         int
+	Cursor        string // from the previous page, empty for the first
+}
+
+// projectCursor is the position after the last project of a page
+type projectCursor struct {
+	Sort  ProjectSort `json:"s"`
+	Value string      `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// ListProjects returns a page of the projects the user can access, and the cursor of the
+// next page, empty on the last one. Projects are loaded without their pipeline data.
+func ListProjects(db *gorm.DB, userID uint, query ProjectListQuery) ([]models.Project, string, error) {
+	if !query.Sort.Valid() {
+		query.Sort = SortUpdated
+	}
+	if query.Limit <= 0 || query.Limit > MaxProjectPageSize {
+		query.Limit = DefaultProjectPageSize
+	}
+
+	tx := db.Omit("Data").
+		Preload("Tags").
+		Scopes(AccessibleBy(userID))
+
+	if tsquery := searchQuery(query.Search); tsquery != "" {
+		tx = tx.Where("to_tsvector('simple', title) @@ to_tsquery('simple', ?)", tsquery)
+	}
+	if len(query.Tags) > 0 {
+		tagged := db.Session(&gorm.Session{NewDB: true}).Table("project_tags").
+			Select("project_tags.project_id").
+			Joins("JOIN tags ON tags.id = project_tags.tag_id").
+			Where("tags.name IN ?", query.Tags).
+			Group("project_tags.project_id").
+			Having("COUNT(DISTINCT tags.id) = ?", len(query.Tags))
+		tx = tx.Where("id IN (?)", tagged)
+	}
+	if query.Folder != nil {
+		tx = tx.Scopes(InFolder(userID, *query.Folder))
+	}
+	if query.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", *query.CreatedBefore)
+	}
+	if query.UpdatedAfter != nil {
+		tx = tx.Where("updated_at >= ?", *query.UpdatedAfter)
+	}
+	if query.UpdatedBefore != nil {
+		tx = tx.Where("updated_at < ?", *query.UpdatedBefore)
+	}
+
+	column := map[ProjectSort]string{
+		SortUpdated: "updated_at",
+		SortCreated: "created_at",
+		SortTitle:   "LOWER(title)",
+	}[query.Sort]
+	direction, after := "DESC", "<"
+	if query.Ascending {
+		direction, after = "ASC", ">"
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort {
+			return nil, "", ErrInvalidCursor
+		}
+		var value interface{} = cursor.Value
+		if query.Sort != SortTitle {
+			if value, err = time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				return nil, "", ErrInvalidCursor
+			}
+		}
+		// ids break ties, so projects sharing a sort value are neither skipped nor repeated
+		tx = tx.Where("("+column+", id) "+after+" (?, ?)", value, cursor.ID)
+	}
+
+	// one extra project tells whether there is a next page
+	var projects []models.Project
+	err := tx.Order(column + " " + direction).
+		Order("id " + direction).
+		Limit(query.Limit + 1).
+		Find(&projects).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(projects) <= query.Limit {
+		return projects, "", nil
+	}
+
+	projects = projects[:query.Limit]
+	last := projects[len(projects)-1]
+	cursor := projectCursor{Sort: query.Sort, ID: last.ID}
+	switch query.Sort {
+	case SortUpdated:
+		cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+	case SortCreated:
+		cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	case SortTitle:
+		cursor.Value = strings.ToLower(last.Title)
+	}
+	next, err := encodeCursor(cursor)
+	return projects, next, err
+}
+
+// searchQuery turns free text into a tsquery matching titles containing every word,
+// treating the last word as a prefix so results update while the user is typing
+func searchQuery(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	for i := range words {
+		words[i] = strings.ToLower(words[i])
+	}
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
+
+func encodeCursor(cursor projectCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (projectCursor, error) {
+	var cursor projectCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(b, &cursor)
+	return cursor, err
+}
@@ -0,0 +1,137 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"!?&|", ""},
+		{"edge", "edge:*"},
+		{"Edge Detect", "edge & detect:*"},
+		{"  edge   detect  ", "edge & detect:*"},
+		{"edge-detect v2", "edge & detect & v2:*"},
+		// operators can't be smuggled into the tsquery
+		{"a & !b | c:*", "a & b & c:*"},
+		{"it's (blur)", "it & s & blur:*"},
+		{"Ünïcode ÉDGE", "ünïcode & édge:*"},
+	}
+	for _, tt := range tests {
+		if got := searchQuery(tt.search); got != tt.want {
+			t.Errorf("searchQuery(%q) = %q, want %q", tt.search, got, tt.want)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []projectCursor{
+		{Sort: SortUpdated, Value: "2026-01-02T03:04:05.123456789Z", ID: 7},
+		{Sort: SortTitle, Value: "edge, detect & \"quotes\"", ID: 1},
+		{},
+	}
+	for _, cursor := range cursors {
+		encoded, err := encodeCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeCursor(encoded)
+		if err != nil || decoded != cursor {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v, %v", cursor, decoded, err)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"title","v":"a","id":1}`))},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("title:a:1"))},
+		{"wrong types", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"a","id":"1"}`))},
+		{"truncated", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":"a"`))},
+	}
+	for _, tt := range tests {
+		if cursor, err := decodeCursor(tt.cursor); err == nil {
+			t.Errorf("%s: decodeCursor = %+v, want an error", tt.name, cursor)
+		}
+	}
+}
+
+func TestListProjectsTamperedCursor(t *testing.T) {
+	user := newUserID()
+	createProject(t, user, "Only")
+
+	tampered := func(cursor projectCursor) string {
+		encoded, err := encodeCursor(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	valid := tampered(projectCursor{Sort: SortUpdated, Value: "2026-01-02T03:04:05Z", ID: 1})
+
+	tests := []struct {
+		name   string
+		sort   ProjectSort
+		cursor string
+	}{
+		{"garbage", SortUpdated, "garbage"},
+		{"edited byte", SortUpdated, valid[:len(valid)-3] + "!!!"},
+		{"from another sort", SortTitle, valid},
+		{"sort rewritten", SortCreated, valid},
+		{"time not a time", SortUpdated, tampered(projectCursor{Sort: SortUpdated, Value: "1; DROP TABLE projects", ID: 1})},
+		{"time in another format", SortCreated, tampered(projectCursor{Sort: SortCreated, Value: "2026-01-02 03:04:05", ID: 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects, next, err := ListProjects(initializers.DB, user, ProjectListQuery{Sort: tt.sort, Cursor: tt.cursor})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("ListProjects = %d projects, %q, %v, want ErrInvalidCursor", len(projects), next, err)
+			}
+		})
+	}
+}
+
+func TestListProjectsPagesByTitle(t *testing.T) {
+	user := newUserID()
+	// two projects share a title, ids break the tie
+	for _, title := range []string{"delta", "Alpha", "charlie", "bravo", "Charlie"} {
+		createProject(t, user, title)
+	}
+
+	var titles []string
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		projects, next, err := ListProjects(initializers.DB, user, ProjectListQuery{Sort: SortTitle, Ascending: true, Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, project := range projects {
+			titles = append(titles, project.Title)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	want := []string{"Alpha", "bravo", "charlie", "Charlie", "delta"}
+	if len(titles) != len(want) {
+		t.Fatalf("paged through %v, want %v", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Fatalf("paged through %v, want %v", titles, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package project_service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	MaxSampleSize        = 10 << 20
+	MaxSamplesPerProject = 20
+	maxSampleNameLength  = 128
+)
+
+var ErrInvalidSample = errors.New("invalid sample image")
+
+// CheckSample validates an uploaded sample image and returns the name to store it under
+// and its content type, sniffed from the data rather than trusted from the client
+func CheckSample(name string, data []byte) (string, string, error) {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "" || name == "." || name == "/" || name == ".." {
+		return "", "", fmt.Errorf("%w: missing file name", ErrInvalidSample)
+	}
+	if len(name) > maxSampleNameLength {
+		return "", "", fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidSample, name, maxSampleNameLength)
+	}
+	if len(data) == 0 {
+		return "", "", fmt.Errorf("%w: %s is empty", ErrInvalidSample, name)
+	}
+	if len(data) > MaxSampleSize {
+		return "", "", fmt.Errorf("%w: %s is over %d MB", ErrInvalidSample, name, MaxSampleSize>>20)
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", "", fmt.Errorf("%w: %s is not an image", ErrInvalidSample, name)
+	}
+	return name, contentType, nil
+}
@@ -0,0 +1,53 @@
+package project_service
+
+import (
+	"crypto/rand"
+	"edward-lemonade/chive/internal/models"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxShareLinkHours is the longest a link can be set to last, a year. Links that should
+// outlive that are made without an expiry.
+const MaxShareLinkHours = 24 * 365
+
+// ErrShareLinkInvalid covers unknown, revoked and expired tokens alike
+var ErrShareLinkInvalid = errors.New("share link is invalid or has expired")
+
+// NewShareToken returns a random, URL safe token for a share link
+func NewShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// FindSharedProject resolves a share token to its project, as long as the link is still
+// live and the project isn't in the trash
+func FindSharedProject(db *gorm.DB, token string) (*models.Project, error) {
+	var link models.ShareLink
+	err := db.Where("token = ? AND revoked_at IS NULL", token).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareLinkInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, ErrShareLinkInvalid
+	}
+
+	var project models.Project
+	err = db.Where("id = ?", link.ProjectID).First(&project).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareLinkInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
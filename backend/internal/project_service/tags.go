@@ -0,0 +1,79 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/models"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxTagsPerProject = 20
+	maxTagLength      = 32
+)
+
+// NormalizeTags trims, lowercases and dedupes tag names, keeping their order
+func NormalizeTags(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	var tags []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", name, maxTagLength)
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	if len(tags) > maxTagsPerProject {
+		return nil, fmt.Errorf("a project can have at most %d tags", maxTagsPerProject)
+	}
+	return tags, nil
+}
+
+// SetProjectTags replaces a project's tags, creating tags that don't exist yet. The
+// names must already be normalized.
+func SetProjectTags(tx *gorm.DB, project *models.Project, names []string) error {
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		tag := models.Tag{Name: name}
+		if err := tx.Where(models.Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return tx.Model(project).Association("Tags").Clear()
+	}
+	return tx.Model(project).Association("Tags").Replace(tags)
+}
+
+// TagNames lists the names of loaded tags
+func TagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// TagCounts lists the tags on the projects the user can access, with how many of those
+// projects have each, most used first
+func TagCounts(db *gorm.DB, userID uint) ([]models.TagInfo, error) {
+	accessible := db.Session(&gorm.Session{NewDB: true}).Model(&models.Project{}).
+		Select("id").
+		Scopes(AccessibleBy(userID))
+
+	tags := []models.TagInfo{}
+	err := db.Table("tags").
+		Select("tags.name, COUNT(*) AS project_count").
+		Joins("JOIN project_tags ON project_tags.tag_id = tags.id").
+		Where("project_tags.project_id IN (?)", accessible).
+		Group("tags.name").
+		Order("project_count DESC, tags.name").
+		Scan(&tags).Error
+	return tags, err
+}
@@ -0,0 +1,43 @@
+package project_service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	many := make([]string, maxTagsPerProject+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	// duplicates don't count against the limit
+	dupes := append(append([]string{}, many[:maxTagsPerProject]...), "T", " t ")
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"trimmed and lowercased", []string{"  Edge ", "BLUR"}, []string{"edge", "blur"}, false},
+		{"deduped in order", []string{"blur", "Edge", "BLUR", "edge"}, []string{"blur", "edge"}, false},
+		{"empty names skipped", []string{"", "  ", "edge"}, []string{"edge"}, false},
+		{"longest tag", []string{strings.Repeat("a", maxTagLength)}, []string{strings.Repeat("a", maxTagLength)}, false},
+		{"tag too long", []string{strings.Repeat("a", maxTagLength+1)}, nil, true},
+		{"most tags", many[:maxTagsPerProject], many[:maxTagsPerProject], false},
+		{"too many tags", many, nil, true},
+		{"too many with duplicates", dupes, many[:maxTagsPerProject], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeTags error = %v, want error %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("NormalizeTags = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Deleted projects sit in the trash, restorable, until they are older than the retention
+// period and get purged for good.
+
+const (
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	purgeInterval         = time.Hour
+)
+
+var (
+	trashRetention = DefaultTrashRetention
+	purgeInitOnce  sync.Once
+)
+
+// InitTrashPurge sets the retention period and starts purging expired projects in the background
+func InitTrashPurge(retention time.Duration) {
+	purgeInitOnce.Do(func() {
+		if retention > 0 {
+			trashRetention = retention
+		}
+		go purger()
+
+		log.Printf("Purging trashed projects after %v", trashRetention)
+	})
+}
+
+// TrashRetention is how long a deleted project can still be restored
+func TrashRetention() time.Duration {
+	return trashRetention
+}
+
+// PurgeAt is when a project deleted at deletedAt will be removed for good
+func PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(trashRetention)
+}
+
+func purger() {
+	purgeExpired()
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purgeExpired()
+	}
+}
+
+// purgeExpired permanently deletes projects that have been in the trash past the
+// retention period, along with their versions, members, share links, tags, folder
+// placements and samples
+func purgeExpired() {
+	var purged int
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var expired []uint
+		err := tx.Unscoped().Model(&models.Project{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-trashRetention)).
+			Pluck("id", &expired).Error
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+
+		if err := tx.Where("project_id IN ?", expired).Delete(&models.ProjectVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", expired).Delete(&models.ProjectMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", expired).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM project_tags WHERE project_id IN ?", expired).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", expired).Delete(&models.FolderProject{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", expired).Delete(&models.ProjectSample{}).Error; err != nil {
+			return err
+		}
+		// forks outlive their parent, they just stop having one
+		if err := tx.Unscoped().Model(&models.Project{}).Where("parent_id IN ?", expired).
+			UpdateColumns(map[string]interface{}{"parent_id": nil, "parent_version": 0}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", expired).Delete(&models.Project{}).Error; err != nil {
+			return err
+		}
+		purged = len(expired)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to purge trashed projects: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Purged %d trashed projects", purged)
+	}
+}
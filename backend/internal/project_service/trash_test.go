@@ -0,0 +1,113 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestPurgeAt(t *testing.T) {
+	deletedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := PurgeAt(deletedAt), deletedAt.Add(trashRetention); !got.Equal(want) {
+		t.Fatalf("PurgeAt = %v, want %v", got, want)
+	}
+}
+
+// trashedAt moves a project into the trash as if it was deleted at deletedAt
+func trashedAt(t *testing.T, project *models.Project, deletedAt time.Time) {
+	t.Helper()
+	err := initializers.DB.Unscoped().Model(project).
+		UpdateColumn("deleted_at", gorm.DeletedAt{Time: deletedAt, Valid: true}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withRows gives a project one of every row that hangs off it
+func withRows(t *testing.T, project *models.Project) {
+	t.Helper()
+	db := initializers.DB
+	rows := []interface{}{
+		&models.ProjectVersion{ProjectID: project.ID, Version: 1, Data: project.Data},
+		&models.ProjectMember{ProjectID: project.ID, UserID: newUserID(), Role: models.RoleViewer},
+		&models.ShareLink{ProjectID: project.ID, Token: "token-" + project.Title},
+		&models.FolderProject{ProjectID: project.ID, UserID: project.CreatorID, FolderID: 1},
+		&models.ProjectSample{ProjectID: project.ID, Name: "sample.png"},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	if err := db.Model(project).Association("Tags").Append(&models.Tag{Name: "tag-" + project.Title}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countRows counts everything purgeExpired should remove along with the project
+func countRows(t *testing.T, projectID uint) map[string]int64 {
+	t.Helper()
+	db := initializers.DB
+	counts := map[string]int64{}
+	tables := map[string]interface{}{
+		"versions":   &models.ProjectVersion{},
+		"members":    &models.ProjectMember{},
+		"shareLinks": &models.ShareLink{},
+		"folders":    &models.FolderProject{},
+		"samples":    &models.ProjectSample{},
+	}
+	for name, model := range tables {
+		var count int64
+		db.Model(model).Where("project_id = ?", projectID).Count(&count)
+		counts[name] = count
+	}
+	var count int64
+	db.Table("project_tags").Where("project_id = ?", projectID).Count(&count)
+	counts["tags"] = count
+	db.Unscoped().Model(&models.Project{}).Where("id = ?", projectID).Count(&count)
+	counts["project"] = count
+	return counts
+}
+
+func TestPurgeExpired(t *testing.T) {
+	creator := newUserID()
+	expired := createProject(t, creator, "expired")
+	withRows(t, expired)
+	trashedAt(t, expired, time.Now().Add(-trashRetention-time.Hour))
+
+	recent := createProject(t, creator, "recent")
+	withRows(t, recent)
+	trashedAt(t, recent, time.Now().Add(-time.Hour))
+
+	live := createProject(t, creator, "live")
+	withRows(t, live)
+
+	fork := createProject(t, creator, "fork")
+	initializers.DB.Model(fork).UpdateColumns(map[string]interface{}{"parent_id": expired.ID, "parent_version": 1})
+
+	purgeExpired()
+
+	for name, count := range countRows(t, expired.ID) {
+		if count != 0 {
+			t.Errorf("expired project still has %d %s", count, name)
+		}
+	}
+	for _, kept := range []*models.Project{recent, live} {
+		for name, count := range countRows(t, kept.ID) {
+			if count != 1 {
+				t.Errorf("project %q has %d %s, want 1", kept.Title, count, name)
+			}
+		}
+	}
+
+	var orphaned models.Project
+	if err := initializers.DB.First(&orphaned, fork.ID).Error; err != nil {
+		t.Fatalf("fork of a purged project: %v", err)
+	}
+	if orphaned.ParentID != nil || orphaned.ParentVersion != 0 {
+		t.Fatalf("fork still points at %v version %d", *orphaned.ParentID, orphaned.ParentVersion)
+	}
+}
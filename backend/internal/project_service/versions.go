@@ -0,0 +1,87 @@
+package project_service
+
+import (
+	"bytes"
+	"edward-lemonade/chive/internal/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every save snapshots the project's pipeline into project_versions. Named versions are
+// kept forever, autosaves only until a project has more than maxAutosaveVersions of them,
+// unless a fork is based on them.
+
+const maxAutosaveVersions = 50
+
+// RecordVersion snapshots project.Data as the project's next version. An unnamed save
+// that doesn't change the pipeline doesn't get a version of its own, the latest one is
+// returned instead. Run it in the same transaction as the save itself.
+func RecordVersion(tx *gorm.DB, project *models.Project, author models.User, message string, autosave bool) (*models.ProjectVersion, error) {
+	return recordVersion(tx, project, author, message, autosave, false)
+}
+
+// RecordRename is RecordVersion for a save that renamed the project. It always records a
+// new version, since saves are checked against the version number and a rename has to
+// make other editors' copies stale like any other change.
+func RecordRename(tx *gorm.DB, project *models.Project, author models.User, message string, autosave bool) (*models.ProjectVersion, error) {
+	return recordVersion(tx, project, author, message, autosave, true)
+}
+
+func recordVersion(tx *gorm.DB, project *models.Project, author models.User, message string, autosave bool, always bool) (*models.ProjectVersion, error) {
+	// lock the project row so concurrent saves can't pick the same version number
+	var locked models.Project
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, project.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var latest models.ProjectVersion
+	err := tx.Where("project_id = ?", project.ID).Order("version DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && !always && message == "" && bytes.Equal(latest.Data, project.Data) {
+		return &latest, nil
+	}
+
+	version := models.ProjectVersion{
+		ProjectID:      project.ID,
+		Version:        latest.Version + 1,
+		AuthorID:       author.ID,
+		AuthorUsername: author.Username,
+		Message:        message,
+		Autosave:       autosave && message == "",
+		Data:           project.Data,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, err
+	}
+
+	if version.Autosave {
+		if err := pruneAutosaves(tx, project.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &version, nil
+}
+
+// pruneAutosaves deletes all but the newest maxAutosaveVersions autosaves of a project,
+// keeping the ones forks still need as the base of a pull
+func pruneAutosaves(tx *gorm.DB, projectID uint) error {
+	var keep []uint
+	err := tx.Model(&models.ProjectVersion{}).
+		Where("project_id = ? AND autosave", projectID).
+		Order("version DESC").
+		Limit(maxAutosaveVersions).
+		Pluck("id", &keep).Error
+	if err != nil || len(keep) < maxAutosaveVersions {
+		return err
+	}
+
+	forkBases := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Project{}).
+		Select("parent_version").
+		Where("parent_id = ?", projectID)
+	return tx.Where("project_id = ? AND autosave AND id NOT IN ? AND version NOT IN (?)", projectID, keep, forkBases).
+		Delete(&models.ProjectVersion{}).Error
+}
@@ -0,0 +1,40 @@
+package project_service
+
+import (
+	"edward-lemonade/chive/internal/initializers"
+	"edward-lemonade/chive/internal/models"
+	"testing"
+)
+
+func TestRecordVersion(t *testing.T) {
+	author := models.User{ID: newUserID(), Username: "author"}
+	project := createProject(t, author.ID, "Versioned")
+
+	tests := []struct {
+		name    string
+		data    string
+		message string
+		rename  bool
+		want    int
+	}{
+		{"first save", `{"nodes":[],"edges":[]}`, "", false, 1},
+		{"unchanged save", `{"nodes":[],"edges":[]}`, "", false, 1},
+		{"changed save", `{"nodes":[{"id":"a"}],"edges":[]}`, "", false, 2},
+		{"named save", `{"nodes":[{"id":"a"}],"edges":[]}`, "checkpoint", false, 3},
+		{"rename", `{"nodes":[{"id":"a"}],"edges":[]}`, "", true, 4},
+	}
+	for _, tt := range tests {
+		record := RecordVersion
+		if tt.rename {
+			record = RecordRename
+		}
+		project.Data = []byte(tt.data)
+		version, err := record(initializers.DB, project, author, tt.message, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if version.Version != tt.want {
+			t.Fatalf("%s: recorded version %d, want %d", tt.name, version.Version, tt.want)
+		}
+	}
+}
@@ -3,18 +3,55 @@ package utils
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+// ZipEntry is a file to add to a zip under the given name, which may contain directories.
+// The contents come from Data when it is set and from the file at Path otherwise.
+type ZipEntry struct {
+	Name string
+	Path string
+	Data []byte
+}
+
+// ErrZipTooLarge is returned by ReadZip when the contents are over the size limit
+var ErrZipTooLarge = errors.New("zip contents are too large")
+
 func CreateZipFromFiles(filePaths []string) (*bytes.Buffer, error) {
+	entries := make([]ZipEntry, 0, len(filePaths))
+	for _, path := range filePaths {
+		// Use base name for the file in the ZIP
+		entries = append(entries, ZipEntry{Name: filepath.Base(path), Path: path})
+	}
+	return CreateZip(entries)
+}
+
+func CreateZip(entries []ZipEntry) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
 	defer zipWriter.Close()
 
-	for _, path := range filePaths {
-		file, err := os.Open(path)
+	for _, entry := range entries {
+		if entry.Data != nil {
+			writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+				Name:     filepath.ToSlash(entry.Name),
+				Method:   zip.Deflate,
+				Modified: time.Now(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if _, err := writer.Write(entry.Data); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		file, err := os.Open(entry.Path)
 		if err != nil {
 			return nil, err
 		}
@@ -31,8 +68,7 @@ func CreateZipFromFiles(filePaths []string) (*bytes.Buffer, error) {
 			return nil, err
 		}
 
-		// Use base name for the file in the ZIP
-		header.Name = filepath.Base(path)
+		header.Name = filepath.ToSlash(entry.Name)
 		header.Method = zip.Deflate
 
 		writer, err := zipWriter.CreateHeader(header)
@@ -48,3 +84,39 @@ func CreateZipFromFiles(filePaths []string) (*bytes.Buffer, error) {
 
 	return buf, nil
 }
+
+// ReadZip reads every file in a zip into memory, keyed by name. Directories are skipped.
+// maxSize caps the total uncompressed size, so a small archive can't unpack into
+// something huge.
+func ReadZip(data []byte, maxSize int64) (map[string][]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(zipReader.File))
+	remaining := maxSize
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		// the header's size can lie, so count what actually comes out
+		contents, err := io.ReadAll(io.LimitReader(reader, remaining+1))
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(contents))
+		if remaining < 0 {
+			return nil, ErrZipTooLarge
+		}
+		files[file.Name] = contents
+	}
+
+	return files, nil
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func zipOf(t *testing.T, entries ...ZipEntry) []byte {
+	t.Helper()
+	buf, err := CreateZip(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadZipSizeLimit(t *testing.T) {
+	// compresses to almost nothing, so only the uncompressed size gives it away
+	big := bytes.Repeat([]byte{0}, 1<<20)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		err     error
+	}{
+		{"under the limit", zipOf(t, ZipEntry{Name: "a", Data: big}), 1 << 20, nil},
+		{"one entry over", zipOf(t, ZipEntry{Name: "a", Data: big}), 1<<20 - 1, ErrZipTooLarge},
+		{"entries add up", zipOf(t, ZipEntry{Name: "a", Data: big}, ZipEntry{Name: "b", Data: big}), 3 << 19, ErrZipTooLarge},
+	}
+	for _, tt := range tests {
+		files, err := ReadZip(tt.data, tt.maxSize)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: ReadZip = %d files, %v, want %v", tt.name, len(files), err, tt.err)
+		}
+	}
+}
+
+func TestReadZipRoundTrip(t *testing.T) {
+	files, err := ReadZip(zipOf(t, ZipEntry{Name: "manifest.json", Data: []byte("{}")}, ZipEntry{Name: "samples/a.png", Data: []byte("png")}), 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || string(files["manifest.json"]) != "{}" || string(files["samples/a.png"]) != "png" {
+		t.Fatalf("ReadZip = %q", files)
+	}
+}
@@ -5,9 +5,14 @@ import (
 	"edward-lemonade/chive/internal/cv_service"
 	"edward-lemonade/chive/internal/initializers"
 	"edward-lemonade/chive/internal/middlewares"
+	"edward-lemonade/chive/internal/project_service"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -19,7 +24,48 @@ func main() {
 
 	numWorkers := runtime.NumCPU() // Typically 4-16
 	queueSize := 16
-	cv_service.InitQueue(numWorkers, queueSize)
+	maxJobsPerUser := max(1, numWorkers/2)
+	if v, err := strconv.Atoi(os.Getenv("MAX_JOBS_PER_USER")); err == nil {
+		maxJobsPerUser = v
+	}
+	cvExePath := os.Getenv("CV_EXE_PATH")
+	if cvExePath == "" {
+		cvExePath = cv_service.DefaultCvExePath()
+	}
+	// one long-lived cv process per worker, CV_EXECUTOR=subprocess forks cv.exe per job instead
+	var executor cv_service.Executor
+	if os.Getenv("CV_EXECUTOR") == "subprocess" {
+		executor = cv_service.NewSubprocessExecutor(cvExePath)
+	} else if pool, err := cv_service.NewProcessPoolExecutor(cvExePath, numWorkers); err != nil {
+		// an older cv.exe without --serve, or none at all, only fails jobs this way
+		log.Printf("Failed to start cv process pool, forking cv.exe per job instead: %v", err)
+		executor = cv_service.NewSubprocessExecutor(cvExePath)
+	} else {
+		executor = pool
+	}
+	// job inputs and outputs go to CV_WORK_DIR, which has to be shared by every instance
+	workDir := os.Getenv("CV_WORK_DIR")
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "chive")
+		log.Printf("CV_WORK_DIR is not set, using %s, which only works with a single backend instance", workDir)
+	}
+	if err := cv_service.CheckWorkDir(workDir); err != nil {
+		log.Fatal("CV_WORK_DIR must be a writable directory shared by every backend instance: ", err)
+	}
+	cv_service.InitQueue(cv_service.QueueConfig{
+		Workers:        numWorkers,
+		QueueSize:      queueSize,
+		MaxJobsPerUser: maxJobsPerUser,
+		Executor:       executor,
+		WorkDir:        workDir,
+	})
+
+	// Deleted projects stay restorable for PROJECT_TRASH_RETENTION_DAYS days
+	trashRetention := project_service.DefaultTrashRetention
+	if v, err := strconv.Atoi(os.Getenv("PROJECT_TRASH_RETENTION_DAYS")); err == nil && v > 0 {
+		trashRetention = time.Duration(v) * 24 * time.Hour
+	}
+	project_service.InitTrashPurge(trashRetention)
 
 	fmt.Printf("Starting image cruncher with %d workers\n", numWorkers)
 
@@ -29,7 +75,7 @@ func main() {
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{os.Getenv("FRONTEND_URL")},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
 		AllowCredentials: true,
 	}))
@@ -44,9 +90,60 @@ func main() {
 	router.GET("/api/project/load", middlewares.CheckAuth, controllers.LoadProject)
 	router.GET("/api/projects/info", middlewares.CheckAuth, controllers.GetProjectInfo)
 	router.GET("/api/projects/infos", middlewares.CheckAuth, controllers.GetProjectInfos)
+	router.GET("/api/projects/trash", middlewares.CheckAuth, controllers.GetTrashedProjects)
+	router.POST("/api/project/import", middlewares.CheckAuth, controllers.ImportProject)
+	router.GET("/api/project/:id/export", middlewares.CheckAuth, controllers.ExportProject)
+	router.PATCH("/api/project/:id", middlewares.CheckAuth, controllers.UpdateProject)
+	router.DELETE("/api/project/:id", middlewares.CheckAuth, controllers.DeleteProject)
+	router.POST("/api/project/:id/duplicate", middlewares.CheckAuth, controllers.DuplicateProject)
+	router.POST("/api/project/:id/restore", middlewares.CheckAuth, controllers.RestoreProject)
+	router.GET("/api/project/:id/forks", middlewares.CheckAuth, controllers.GetProjectForks)
+	router.POST("/api/project/:id/pull", middlewares.CheckAuth, controllers.PullUpstream)
+	router.PUT("/api/project/:id/folder", middlewares.CheckAuth, controllers.MoveProjectToFolder)
+	router.GET("/api/project/:id/samples", middlewares.CheckAuth, controllers.GetProjectSamples)
+	router.POST("/api/project/:id/samples", middlewares.CheckAuth, controllers.UploadProjectSamples)
+	router.GET("/api/project/:id/samples/:sampleId", middlewares.CheckAuth, controllers.GetProjectSample)
+	router.DELETE("/api/project/:id/samples/:sampleId", middlewares.CheckAuth, controllers.DeleteProjectSample)
+	router.GET("/api/project/:id/versions", middlewares.CheckAuth, controllers.GetProjectVersions)
+	router.GET("/api/project/:id/versions/:version", middlewares.CheckAuth, controllers.GetProjectVersion)
+	router.POST("/api/project/:id/versions/:version/restore", middlewares.CheckAuth, controllers.RestoreProjectVersion)
+	router.GET("/api/project/:id/members", middlewares.CheckAuth, controllers.GetProjectMembers)
+	router.POST("/api/project/:id/members", middlewares.CheckAuth, controllers.AddProjectMember)
+	router.PATCH("/api/project/:id/members/:userId", middlewares.CheckAuth, controllers.UpdateProjectMember)
+	router.DELETE("/api/project/:id/members/:userId", middlewares.CheckAuth, controllers.RemoveProjectMember)
+	router.GET("/api/project/:id/share", middlewares.CheckAuth, controllers.GetShareLinks)
+	router.POST("/api/project/:id/share", middlewares.CheckAuth, controllers.CreateShareLink)
+	router.DELETE("/api/project/:id/share/:linkId", middlewares.CheckAuth, controllers.RevokeShareLink)
+	router.POST("/api/project/:id/publish", middlewares.CheckAuth, controllers.PublishProject)
+	router.DELETE("/api/project/:id/publish", middlewares.CheckAuth, controllers.UnpublishProject)
+
+	// Folder and tag routes
+	router.GET("/api/folders", middlewares.CheckAuth, controllers.GetFolders)
+	router.POST("/api/folders", middlewares.CheckAuth, controllers.CreateFolder)
+	router.PATCH("/api/folders/:folderId", middlewares.CheckAuth, controllers.RenameFolder)
+	router.DELETE("/api/folders/:folderId", middlewares.CheckAuth, controllers.DeleteFolder)
+	router.GET("/api/tags", middlewares.CheckAuth, controllers.GetTags)
+
+	// Template routes
+	router.GET("/api/templates", middlewares.CheckAuth, controllers.GetTemplates)
+	router.GET("/api/templates/:id", middlewares.CheckAuth, controllers.GetTemplate)
+	router.POST("/api/templates/:id/use", middlewares.CheckAuth, controllers.UseTemplate)
+
+	// Public routes, no CheckAuth
+	router.GET("/api/share/:token", controllers.GetSharedProject)
 
 	// Pipeline routes
+	router.GET("/api/nodes", middlewares.CheckAuth, controllers.GetNodes)
 	router.POST("/api/pipe", middlewares.CheckAuth, controllers.Pipe)
+	router.POST("/api/pipeline/validate", middlewares.CheckAuth, controllers.ValidatePipeline)
+	router.POST("/api/pipeline/diff", middlewares.CheckAuth, controllers.DiffPipelines)
+
+	// Job routes
+	router.POST("/api/jobs", middlewares.CheckAuth, controllers.CreateJob)
+	router.GET("/api/jobs/:id", middlewares.CheckAuth, controllers.GetJob)
+	router.GET("/api/jobs/:id/result", middlewares.CheckAuth, controllers.GetJobResult)
+	router.DELETE("/api/jobs/:id", middlewares.CheckAuth, controllers.CancelJob)
+	router.GET("/api/queue", middlewares.CheckAuth, controllers.GetQueueStats)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -7,6 +7,13 @@
 #include <filesystem>
 #include <chrono>
 #include <sstream>
+#include <cstdint>
+#include <functional>
+
+#ifdef _WIN32
+#include <io.h>
+#include <fcntl.h>
+#endif
 
 #include <opencv2/opencv.hpp>
 #include <nlohmann/json.hpp>
@@ -18,18 +25,21 @@ using json = nlohmann::json;
 using namespace std;
 namespace fs = std::filesystem;
 
-// usage .\cv.exe --output <outputDir> --input <image1> [image2 ...] [--pipeline <pipelineJson>]
+// usage .\cv.exe --output <outputDir> --input <image1> [image2 ...] [--pipeline <pipelineJson>] [--capture all|<nodeId,...>]
+//    or .\cv.exe --serve   (long-lived worker, see serve() below)
 
+// the backend sends node types as stable string keys, see cvNodeTypeFromKey
 enum class CvNodeType {
-    Source = 0,
-    Output = 1,
-    Blur = 2,
-    DeepFry = 3
+    Unknown,
+    Source,
+    Output,
+    Blur,
+    DeepFry
 };
 
 struct PipelineNode {
     string id;
-    CvNodeType cvNodeType;
+    CvNodeType cvNodeType = CvNodeType::Unknown;
     unordered_map<string, string> params; // Store params as string key-value pairs
 };
 struct PipelineEdge {
@@ -37,9 +47,62 @@ struct PipelineEdge {
     string target;
 };
 
+// nodes whose output image is saved along with the final result, for debugging pipelines
+struct CaptureOptions {
+    bool all = false;
+    unordered_set<string> nodeIds;
+
+    bool includes(const string& nodeId) const {
+        return all || nodeIds.count(nodeId) > 0;
+    }
+};
+
+// node IDs end up as directory names, so anything unusual is never captured
+bool isSafeNodeDir(const string& nodeId) {
+    if (nodeId.empty() || nodeId == "." || nodeId == "..") {
+        return false;
+    }
+    for (char c : nodeId) {
+        if (!isalnum(static_cast<unsigned char>(c)) && c != '-' && c != '_' && c != '.') {
+            return false;
+        }
+    }
+    return true;
+}
+
+CaptureOptions parseCapture(const string& value) {
+    CaptureOptions capture;
+    if (value == "all") {
+        capture.all = true;
+        return capture;
+    }
+    stringstream ss(value);
+    string nodeId;
+    while (getline(ss, nodeId, ',')) {
+        if (!nodeId.empty()) {
+            capture.nodeIds.insert(nodeId);
+        }
+    }
+    return capture;
+}
+
+using NodeOutputCallback = function<void(const string& nodeId, const cv::Mat& output)>;
+
 // ====================================================================================================
 // SETUP
 
+// keys must match the node registry in the backend (pipeline_service/nodes.go)
+CvNodeType cvNodeTypeFromKey(const string& key) {
+    static const unordered_map<string, CvNodeType> types = {
+        {"source", CvNodeType::Source},
+        {"output", CvNodeType::Output},
+        {"blur", CvNodeType::Blur},
+        {"deepfry", CvNodeType::DeepFry},
+    };
+    auto it = types.find(key);
+    return it == types.end() ? CvNodeType::Unknown : it->second;
+}
+
 bool parsePipeline(const string& jsonStr, vector<PipelineNode>& nodes, vector<PipelineEdge>& edges) {
     try {
         json j = json::parse(jsonStr);
@@ -56,9 +119,12 @@ bool parsePipeline(const string& jsonStr, vector<PipelineNode>& nodes, vector<Pi
                 if (nodeJson.contains("data") && nodeJson["data"].is_object()) {
                     const auto& data = nodeJson["data"];
                     
-                    if (data.contains("cvNodeType") && data["cvNodeType"].is_number()) {
-                        int cvNodeTypeInt = data["cvNodeType"].get<int>();
-                        node.cvNodeType = static_cast<CvNodeType>(cvNodeTypeInt);
+                    if (data.contains("cvNodeType") && data["cvNodeType"].is_string()) {
+                        string key = data["cvNodeType"].get<string>();
+                        node.cvNodeType = cvNodeTypeFromKey(key);
+                        if (node.cvNodeType == CvNodeType::Unknown) {
+                            cerr << "Warning: Node " << node.id << " has unknown type " << key << endl;
+                        }
                     }
                     
                     if (data.contains("params") && data["params"].is_object()) {
@@ -188,7 +254,8 @@ cv::Mat processNode(
     const string& nodeId,
     const cv::Mat& input,
     const unordered_map<string, PipelineNode>& nodeMap,
-    const unordered_map<string, vector<string>>& graph
+    const unordered_map<string, vector<string>>& graph,
+    const NodeOutputCallback& onNodeOutput = nullptr
 ) {
     if (nodeMap.find(nodeId) == nodeMap.end()) {
         cerr << "Warning: Node " << nodeId << " not found, returning input" << endl;
@@ -198,6 +265,9 @@ cv::Mat processNode(
     const auto& node = nodeMap.at(nodeId);
     
     cv::Mat output = executeCvOperation(node, input);
+    if (onNodeOutput) {
+        onNodeOutput(nodeId, output);
+    }
     
     // if this is an output node, return the result
     if (node.cvNodeType == CvNodeType::Output) {
@@ -212,7 +282,7 @@ cv::Mat processNode(
             // default behavior is use the last output's result, prob change this in the future
             cv::Mat finalOutput = output;
             for (const auto& targetNodeId : outgoingEdges) {
-                finalOutput = processNode(targetNodeId, output, nodeMap, graph);
+                finalOutput = processNode(targetNodeId, output, nodeMap, graph, onNodeOutput);
             }
             return finalOutput;
         }
@@ -222,13 +292,185 @@ cv::Mat processNode(
     return output;
 }
 
+// ====================================================================================================
+// SERVE MODE
+// Framed protocol used by the backend's ProcessPoolExecutor (process_pool.go). Every frame is
+// a 4-byte big-endian length followed by that many bytes. A request is a JSON header frame,
+// followed for "process" requests by one frame of encoded image bytes per entry in "images".
+// The response mirrors it: a JSON header, then for each image that didn't fail a frame with
+// the result followed by one frame per captured node listed in that image's "nodes".
+// Only frames go to stdout in this mode, logs must go to cerr.
+
+bool readFrame(istream& in, string& payload) {
+    unsigned char header[4];
+    if (!in.read(reinterpret_cast<char*>(header), 4)) {
+        return false;
+    }
+    uint32_t length = (uint32_t(header[0]) << 24) | (uint32_t(header[1]) << 16) |
+                      (uint32_t(header[2]) << 8) | uint32_t(header[3]);
+
+    payload.resize(length);
+    if (length == 0) {
+        return true;
+    }
+    return static_cast<bool>(in.read(&payload[0], length));
+}
+
+void writeFrame(ostream& out, const string& payload) {
+    uint32_t length = static_cast<uint32_t>(payload.size());
+    unsigned char header[4] = {
+        static_cast<unsigned char>((length >> 24) & 0xff),
+        static_cast<unsigned char>((length >> 16) & 0xff),
+        static_cast<unsigned char>((length >> 8) & 0xff),
+        static_cast<unsigned char>(length & 0xff),
+    };
+    out.write(reinterpret_cast<const char*>(header), 4);
+    out.write(payload.data(), payload.size());
+}
+
+void writeError(const string& id, const string& message) {
+    json response = {{"type", "error"}, {"id", id}, {"error", message}};
+    writeFrame(cout, response.dump());
+    cout.flush();
+}
+
+int serve() {
+#ifdef _WIN32
+    _setmode(_fileno(stdin), _O_BINARY);
+    _setmode(_fileno(stdout), _O_BINARY);
+#endif
+    ios::sync_with_stdio(false);
+
+    string frame;
+    while (readFrame(cin, frame)) {
+        json request = json::parse(frame, nullptr, false);
+        if (request.is_discarded() || !request.is_object()) {
+            // can't tell how many image frames follow, so the stream is unusable
+            cerr << "Invalid request header, exiting" << endl;
+            return 1;
+        }
+
+        string type = request.value("type", "");
+        string id = request.value("id", "");
+
+        if (type == "ping") {
+            json response = {{"type", "pong"}, {"id", id}};
+            writeFrame(cout, response.dump());
+            cout.flush();
+            continue;
+        }
+
+        // read every image frame up front so the stream stays in sync whatever happens next
+        json images = request.contains("images") && request["images"].is_array() ? request["images"] : json::array();
+        vector<string> payloads(images.size());
+        for (auto& payload : payloads) {
+            if (!readFrame(cin, payload)) {
+                return 1;
+            }
+        }
+
+        if (type != "process") {
+            writeError(id, "unknown request type: " + type);
+            continue;
+        }
+
+        vector<PipelineNode> nodes;
+        vector<PipelineEdge> edges;
+        string pipelineJson = request.contains("pipeline") ? request["pipeline"].dump() : "";
+        if (!parsePipeline(pipelineJson, nodes, edges)) {
+            writeError(id, "failed to parse pipeline");
+            continue;
+        }
+        auto nodeMap = buildNodeMap(nodes);
+        auto graph = buildGraph(nodes, edges);
+        string startNodeId = findStartNode(nodeMap, edges);
+
+        CaptureOptions capture;
+        if (request.contains("capture") && request["capture"].is_object()) {
+            capture.all = request["capture"].value("all", false);
+            if (request["capture"].contains("nodeIds") && request["capture"]["nodeIds"].is_array()) {
+                for (const auto& nodeId : request["capture"]["nodeIds"]) {
+                    if (nodeId.is_string()) {
+                        capture.nodeIds.insert(nodeId.get<string>());
+                    }
+                }
+            }
+        }
+
+        json results = json::array();
+        vector<string> outputs;
+        for (size_t i = 0; i < images.size(); i++) {
+            string name = images[i].value("name", "");
+            string ext = fs::path(name).extension().string();
+            if (ext.empty()) {
+                ext = ".png";
+            }
+
+            try {
+                vector<uchar> buffer(payloads[i].begin(), payloads[i].end());
+                cv::Mat image = cv::imdecode(buffer, cv::IMREAD_COLOR);
+                if (image.empty()) {
+                    results.push_back({{"name", name}, {"error", "failed to decode image"}});
+                    continue;
+                }
+
+                json capturedIds = json::array();
+                vector<string> captured;
+                NodeOutputCallback onNodeOutput = [&](const string& nodeId, const cv::Mat& output) {
+                    vector<uchar> nodeEncoded;
+                    if (!capture.includes(nodeId) || !isSafeNodeDir(nodeId) || output.empty() ||
+                        !cv::imencode(ext, output, nodeEncoded)) {
+                        return;
+                    }
+                    capturedIds.push_back(nodeId);
+                    captured.emplace_back(nodeEncoded.begin(), nodeEncoded.end());
+                };
+
+                cv::Mat result = processNode(startNodeId, image, nodeMap, graph, onNodeOutput);
+
+                vector<uchar> encoded;
+                if (result.empty() || !cv::imencode(ext, result, encoded)) {
+                    results.push_back({{"name", name}, {"error", "failed to encode result"}});
+                    continue;
+                }
+
+                json entry = {{"name", name}};
+                if (!capturedIds.empty()) {
+                    entry["nodes"] = capturedIds;
+                }
+                results.push_back(entry);
+                outputs.emplace_back(encoded.begin(), encoded.end());
+                for (auto& nodeOutput : captured) {
+                    outputs.push_back(move(nodeOutput));
+                }
+            } catch (const exception& e) {
+                results.push_back({{"name", name}, {"error", e.what()}});
+            }
+        }
+
+        json response = {{"type", "result"}, {"id", id}, {"images", results}};
+        writeFrame(cout, response.dump());
+        for (const auto& output : outputs) {
+            writeFrame(cout, output);
+        }
+        cout.flush();
+    }
+
+    return 0;
+}
+
 
 int main(int argc, char* argv[]) {
 	auto startTime = chrono::high_resolution_clock::now();
 
+	if (argc == 2 && string(argv[1]) == "--serve") {
+		return serve();
+	}
+
 	string outputDir;
 	vector<string> imagePaths;
 	string pipelineJson;
+	CaptureOptions capture;
 
 	// parse input and output directories
 	for (int i = 1; i < argc; i++) {
@@ -239,13 +481,15 @@ int main(int argc, char* argv[]) {
         } else if (arg == "--input") {
             for (int j = i + 1; j < argc; j++) {
                 string nextArg = argv[j];
-                if (nextArg == "--pipeline" || nextArg == "--output") {
+                if (nextArg == "--pipeline" || nextArg == "--output" || nextArg == "--capture") {
                     break;
                 }
                 imagePaths.push_back(nextArg);
             }
         } else if (arg == "--pipeline" && i + 1 < argc) {
             pipelineJson = argv[++i];
+        } else if (arg == "--capture" && i + 1 < argc) {
+            capture = parseCapture(argv[++i]);
         }
     }
 
@@ -286,10 +530,22 @@ int main(int argc, char* argv[]) {
             continue;
         }
 
+        // captured nodes go to <outputDir>/nodes/<nodeId>/<filename>
+        NodeOutputCallback onNodeOutput = [&](const string& nodeId, const cv::Mat& output) {
+            if (!capture.includes(nodeId) || !isSafeNodeDir(nodeId) || output.empty()) {
+                return;
+            }
+            fs::path nodeDir = fs::path(outputDir) / "nodes" / nodeId;
+            fs::create_directories(nodeDir);
+            if (!cv::imwrite((nodeDir / filename).string(), output)) {
+                cerr << "Failed to save output of node " << nodeId << endl;
+            }
+        };
+
         cv::Mat result;
         
         if (!startNodeId.empty() && nodeMap.find(startNodeId) != nodeMap.end()) {
-            result = processNode(startNodeId, image.clone(), nodeMap, graph);
+            result = processNode(startNodeId, image.clone(), nodeMap, graph, onNodeOutput);
         }
 
         if (!cv::imwrite(outputPath, result)) {
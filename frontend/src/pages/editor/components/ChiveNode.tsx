@@ -1,13 +1,15 @@
 import { useCallback, useMemo } from 'react';
 import { Handle, Position, useUpdateNodeInternals } from '@xyflow/react';
-import { CvNode, CV_NODE_CONFIGS, CvNodeType, buildDefaultParams, CvNodeConfig, ParamSpec, CvNodeParamsMap } from '@/types/CvNode';
+import { CvNode, CvNodeType, buildDefaultParams, CvNodeConfig } from '@/types/CvNode';
 import useEditorStore from '../store';
 
 
-function ChiveNode<T extends CvNodeType>(props: CvNode<T>) {
+function ChiveNode(props: CvNode) {
 	const { id, data, selected } = props;
 	const params = data.params;
-	const CONFIG: CvNodeConfig<T> = useMemo(() => CV_NODE_CONFIGS[data.cvNodeType] as CvNodeConfig<T>, [data.cvNodeType]);
+	const nodeConfigs = useEditorStore(state => state.nodeConfigs);
+	// undefined for types this server doesn't know, which validation reports
+	const CONFIG: CvNodeConfig | undefined = useMemo(() => nodeConfigs?.[data.cvNodeType], [nodeConfigs, data.cvNodeType]);
 
 	const updateNodeHandles = useUpdateNodeInternals();
 
@@ -25,13 +27,13 @@ function ChiveNode<T extends CvNodeType>(props: CvNode<T>) {
 	);
 	const onTypeChange = useCallback(
 		(e: React.ChangeEvent<HTMLSelectElement>) => {
-			const newType: CvNodeType = Number(e.target.value);
+			const newType = e.target.value as CvNodeType;
 			updateNode({ 
 				cvNodeType: newType,
-				params: buildDefaultParams(newType) as any,
+				params: buildDefaultParams(nodeConfigs?.[newType]),
 			});
 		},
-		[updateNode]
+		[updateNode, nodeConfigs]
 	);
 
 	const handles = useMemo(() => {
@@ -61,10 +63,10 @@ function ChiveNode<T extends CvNodeType>(props: CvNode<T>) {
 		};
 
 		return {
-			left: makeHandles(CONFIG.inputs ?? 0, 'left'),
-			right: makeHandles(CONFIG.outputs ?? 0, 'right'),
+			left: makeHandles(CONFIG?.inputs ?? 0, 'left'),
+			right: makeHandles(CONFIG?.outputs ?? 0, 'right'),
 		};
-	}, [CONFIG.inputs, CONFIG.outputs, updateNodeHandles]);
+	}, [CONFIG?.inputs, CONFIG?.outputs, updateNodeHandles]);
 
 
 	return (
@@ -104,27 +106,28 @@ function ChiveNode<T extends CvNodeType>(props: CvNode<T>) {
 					value={data.cvNodeType}
 					onChange={onTypeChange}
 				>
-					{Object.entries(CV_NODE_CONFIGS).map(([key, config]) => (
+					{Object.entries(nodeConfigs ?? {}).map(([key, config]) => (
 						<option key={key} value={config.cvNodeType}>{config.displayName}</option>
 					))}
 				</select>
 
 				{Object.entries(params).map(([field, val]) => {
-					const spec = CONFIG.paramSpecs[field as keyof CvNodeParamsMap[T]] as ParamSpec<T>;
+					const spec = CONFIG?.paramSpecs[field];
 					return (
 						<>
 							<div 
 								className="text-xs font-medium text-green-200 cursor-pointer"
-								title={spec.description}
-							>{spec.displayName}</div>
+								title={spec?.description}
+							>{spec?.displayName ?? field}</div>
 
 							<input
 								type="number"
-								min={1}
+								min={spec?.min}
+								max={spec?.max}
 								className="nodrag w-40 bg-transparent text-green-200 text-xs font-medium 
 										focus:outline-none hover:bg-white/5 px-1 py-1 transition-colors 
 										focus:ring-2 focus:ring-blue-500"
-								value={val}
+								value={Number(val)}
 								onChange={e => updateNode({
 									...data,
 									params: {
@@ -9,7 +9,7 @@ import apiClient from "@/middleware/api";
 import { useNavigate, useParams } from "react-router-dom";
 import useEditorStore, { defaultNode } from './store';
 import Brand from "@/components/Brand";
-import { buildDefaultParams, CvNode, CvNodeType } from "@/types/CvNode";
+import { buildDefaultParams, buildNodeConfigs, CvNode, CvNodeType } from "@/types/CvNode";
 import ChiveNode from "./components/ChiveNode";
 import FileUploadIcon from '@mui/icons-material/FileUpload';
 import CloseIcon from '@mui/icons-material/Close';
@@ -25,7 +25,7 @@ function EditorContent() {
 
 	const navigate = useNavigate();
 	const { screenToFlowPosition } = useReactFlow();
-	const { nodes, edges, onNodesChange, onEdgesChange, onConnect, setNodes, setEdges, selectedNode, setSelectedNode } = useEditorStore();
+	const { nodes, edges, onNodesChange, onEdgesChange, onConnect, setNodes, setEdges, selectedNode, setSelectedNode, nodeConfigs, setNodeConfigs } = useEditorStore();
 
 	const [menuOpen, setMenuOpen] = useState(false);
 	const menuAnchorRef = useRef<HTMLButtonElement>(null);
@@ -59,6 +59,23 @@ function EditorContent() {
 		}
 	}, [id])
 
+	// Node types come from the server's registry, so the palette matches what it can run
+	useEffect(() => {
+		const fetchNodeConfigs = async () => {
+			const res = await apiClient.get('/nodes');
+			if (res.status != 200) {
+				console.error("Error fetching node types");
+				return
+			}
+
+			setNodeConfigs(buildNodeConfigs(res.data.nodes));
+		}
+
+		if (!nodeConfigs) {
+			fetchNodeConfigs();
+		}
+	}, [])
+
 	const addNewNode = useCallback(() => (cvNodeType: CvNodeType = CvNodeType.Source) => {
 		const viewportCenter = {
 			x: window.innerWidth / 2,
@@ -74,7 +91,7 @@ function EditorContent() {
 			data: {
 				...defaultNode.data,
 				name: "New Node",
-				params: buildDefaultParams(cvNodeType),
+				params: buildDefaultParams(useEditorStore.getState().nodeConfigs?.[cvNodeType]),
 			}
 		};
 
@@ -122,40 +139,63 @@ function EditorContent() {
 				createdAt: new Date().toISOString(),
 				updatedAt: new Date().toISOString(),
 			}
-			return {...newProject, updatedAt: new Date().toISOString()};
+			return newProject;
 		} else {
-			return {...project, title, data: { nodes, edges }, updatedAt: new Date().toISOString()};
+			// updatedAt and version stay what the server sent, they are the base of the save
+			return {...project, title, data: { nodes, edges }};
 		}
 	}, [project, title, nodes, edges]);
 
-	const saveProject = useCallback(async () => {
+	// Returns whether the project was saved
+	const saveProject = useCallback(async (): Promise<boolean> => {
 		const json = jsonProject();
-		const res = await apiClient.post('/project/save', json);
-		if (res.status === 200) {
-			console.log("Project saved successfully");
-
-			if (res.data.project && res.data.project.id) {
-				const savedProject = res.data.project;
-				setProject(prev => {
-					if (!prev || prev.id === 0) {
-						return {
-							...json,
-							id: savedProject.id,
-							createdAt: savedProject.createdAt,
-							updatedAt: savedProject.updatedAt,
-						};
-					} else {
-						return {
-							...prev,
-							title: savedProject.title,
-							updatedAt: savedProject.updatedAt,
-						};
-					}
-				});
+		const res = await apiClient.post('/project/save', {
+			...json,
+			// the server rejects the save if the project changed since this copy was loaded
+			baseVersion: json.version ?? 0,
+			baseUpdatedAt: json.id ? json.updatedAt : "",
+		}, {
+			validateStatus: (status) => status === 200 || status === 409,
+		});
+		if (res.status === 409) {
+			const latest = res.data.project;
+			if (!latest) {
+				alert(res.data.error);
+				return false;
 			}
-		} else {
-			console.error("Failed to save project");
+			console.error("Project was changed since it was loaded");
+			if (window.confirm("This project was changed since you loaded it. Load the latest version? Your unsaved changes will be lost.")) {
+				setProject({ ...json, ...latest, version: res.data.version });
+				setNodes(latest.data.nodes);
+				setEdges(latest.data.edges);
+				setTitle(latest.title);
+			}
+			return false;
 		}
+
+		console.log("Project saved successfully");
+		if (res.data.project && res.data.project.id) {
+			const savedProject = res.data.project;
+			setProject(prev => {
+				if (!prev || prev.id === 0) {
+					return {
+						...json,
+						id: savedProject.id,
+						createdAt: savedProject.createdAt,
+						updatedAt: savedProject.updatedAt,
+						version: res.data.version,
+					};
+				} else {
+					return {
+						...prev,
+						title: savedProject.title,
+						updatedAt: savedProject.updatedAt,
+						version: res.data.version,
+					};
+				}
+			});
+		}
+		return true;
 	}, [jsonProject]);
 
 
@@ -165,8 +205,9 @@ function EditorContent() {
 	}
 
 	const handleSaveAndExit = async () => {
-		await saveProject();
-		navigate("/projects");
+		if (await saveProject()) {
+			navigate("/projects");
+		}
 	}
 
 	const handleExit = () => {
@@ -383,7 +424,7 @@ function EditorContent() {
 	return (
 		<div className="h-screen w-screen flex bg-transparent overflow-hidden relative">
 			{/* Loading overlay */}
-			{!isLoaded && (
+			{(!isLoaded || !nodeConfigs) && (
 				<div className="absolute inset-0 z-9999 bg-black/50 backdrop-blur-sm flex items-center justify-center">
 					<div className="flex flex-col items-center gap-4">
 						{/* Spinner */}
@@ -477,7 +518,7 @@ function EditorContent() {
 
 			{/* Center: React Flow canvas */}
 			<div className="flex-1 relative overflow-hidden">
-				<ReactFlow
+				{nodeConfigs && <ReactFlow
 					nodes={nodes}
 					edges={edges}
 					nodeTypes={nodeTypes as any}
@@ -491,7 +532,7 @@ function EditorContent() {
 				>
 					<Background bgColor='#001814' color='rgba(255,255,255,0.5)' gap={24} />
 					<Controls />
-				</ReactFlow>
+				</ReactFlow>}
 
 				{/* Right sidebar that appears when node is selected */}
 				<aside
@@ -37,6 +37,10 @@ export const useEditorStore = create<EditorState>((set, get) => ({
 	setEdges: (edges) => {
 		set({ edges });
 	},
+	nodeConfigs: null,
+	setNodeConfigs: (nodeConfigs) => {
+		set({ nodeConfigs });
+	},
 
 	// Events
 
@@ -12,6 +12,7 @@ export interface ChiveProject {
 	},
 	createdAt: string,
 	updatedAt: string,
+	version?: number, // the latest version when loaded or saved, sent back as baseVersion
 }
 
 export interface ChiveProjectInfo {
@@ -1,109 +1,115 @@
 import { Node } from "@xyflow/react";
 
-export interface CvNode<T extends CvNodeType = CvNodeType> extends Node {
+export interface CvNode extends Node {
 	data: {
 		name: string;
 		cvNodeType: CvNodeType;
-		params: CvNodeParamsMap[T];
+		params: CvNodeParams;
 	}
 }
 
-export interface CvNodeConfig<T extends CvNodeType = CvNodeType> {
+export type ParamValue = number | boolean | string;
+export type CvNodeParams = {[key: string]: ParamValue};
+
+export interface CvNodeConfig {
 	cvNodeType: CvNodeType,
 	displayName: string,
+	description: string,
 	inputs: number,
 	outputs: number,
-	paramSpecs: {[K in keyof CvNodeParamsMap[T]]: ParamSpec<CvNodeParamsMap[T][K]>}
+	paramSpecs: {[key: string]: ParamSpec}
 }
 
+// Node configs by type, in palette order
+export type CvNodeConfigs = {[key: string]: CvNodeConfig};
+
 // ===============================================================================================
 
+// Values match the backend's ParamControl
 export enum ParamControlStyle {
-	IntBox,
-	NumBox,
-	IntSlider,
-	NumSlider,
-	Toggle,
+	IntBox = "intBox",
+	NumBox = "numBox",
+	IntSlider = "intSlider",
+	NumSlider = "numSlider",
+	Toggle = "toggle",
 }
-export interface ParamSpec<T> {
+export interface ParamSpec {
 	displayName: string,
 	description: string,
 	controlStyle: ParamControlStyle,
-	default: T,
+	required: boolean,
+	default: ParamValue,
 
 	min?: number,
 	max?: number,
-	options?: T[],
+	options?: ParamValue[],
 }
 
 // ===============================================================================================
 
+// Keys match the backend's node types, which is how pipelines are stored
 export enum CvNodeType {
-	Source,
-	Output,
-	Blur,
-	DeepFry,
+	Source = "source",
+	Output = "output",
+	Blur = "blur",
+	DeepFry = "deepfry",
 }
-export const CV_NODE_CONFIGS: {
-  	[K in CvNodeType]: CvNodeConfig<K>
-} = {
-	[CvNodeType.Source]: {
-		cvNodeType: CvNodeType.Source,
-		displayName: "Source",
-		inputs: 0,
-		outputs: 1,
-		paramSpecs: {},
-	},
-	[CvNodeType.Output]: {
-		cvNodeType: CvNodeType.Output,
-		displayName: "Output",
-		inputs: 1,
-		outputs: 0,
-		paramSpecs: {},
-	},
-	[CvNodeType.Blur]: {
-		cvNodeType: CvNodeType.Blur,
-		displayName: "Blur",
-		inputs: 1,
-		outputs: 1,
-		paramSpecs: {
-			size: {
-				displayName: "Kernel size",
-				description: "The higher the value, the stronger the blur",
-				controlStyle: ParamControlStyle.IntBox,
 
-				default: 5,
-				min: 1,
-			}
-		},
-	},
-	[CvNodeType.DeepFry]: {
-		cvNodeType: CvNodeType.DeepFry,
-		displayName: "Deep Fry",
-		inputs: 1,
-		outputs: 1,
-		paramSpecs: {},
-	},
+// A node type as listed by GET /api/nodes, the backend's node registry
+export interface CvNodeDefinition {
+	key: CvNodeType,
+	displayName: string,
+	description: string,
+	inputs: number,
+	outputs: number,
+	params: {
+		key: string,
+		displayName: string,
+		description: string,
+		kind: "int" | "number" | "bool",
+		control: ParamControlStyle,
+		required: boolean,
+		default: ParamValue,
+		min?: number,
+		max?: number,
+		options?: ParamValue[],
+	}[],
 }
 
-export type CvNodeParamsMap = {
-	[CvNodeType.Source]: {};
-	[CvNodeType.Output]: {};
-	[CvNodeType.Blur]: {
-		size: number
-	};
-	[CvNodeType.DeepFry]: {};
-};
+export function buildNodeConfigs(definitions: CvNodeDefinition[]): CvNodeConfigs {
+	const configs: CvNodeConfigs = {};
+	for (const definition of definitions) {
+		const paramSpecs: {[key: string]: ParamSpec} = {};
+		for (const param of definition.params) {
+			paramSpecs[param.key] = {
+				displayName: param.displayName,
+				description: param.description,
+				controlStyle: param.control,
+				required: param.required,
+				default: param.default,
+				min: param.min,
+				max: param.max,
+				options: param.options,
+			};
+		}
+		configs[definition.key] = {
+			cvNodeType: definition.key,
+			displayName: definition.displayName,
+			description: definition.description,
+			inputs: definition.inputs,
+			outputs: definition.outputs,
+			paramSpecs,
+		};
+	}
+	return configs;
+}
 
-export function buildDefaultParams<T extends CvNodeType>(
-    type: T
-): CvNodeParamsMap[T] {
-    const paramSpecs = CV_NODE_CONFIGS[type].paramSpecs;
-    const result = {} as CvNodeParamsMap[T];
+export function buildDefaultParams(config: CvNodeConfig | undefined): CvNodeParams {
+    const result: CvNodeParams = {};
+    if (!config) return result;
 
-    for (const key in paramSpecs) {
-        const spec = paramSpecs[key];
-        result[key] = spec.default;
+    for (const key in config.paramSpecs) {
+        result[key] = config.paramSpecs[key].default;
     }
 
     return result;
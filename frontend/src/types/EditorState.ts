@@ -5,7 +5,7 @@ import {
 	type OnEdgesChange,
 	type OnConnect,
 } from '@xyflow/react';
-import { CvNode } from './CvNode';
+import { CvNode, CvNodeConfigs } from './CvNode';
  
 
 export type EditorState = {
@@ -18,4 +18,6 @@ export type EditorState = {
 	setEdges: (edges: Edge[]) => void;
 	selectedNode: CvNode | null;
 	setSelectedNode: (node: CvNode | null) => void;
+	nodeConfigs: CvNodeConfigs | null; // from GET /api/nodes, null until loaded
+	setNodeConfigs: (nodeConfigs: CvNodeConfigs) => void;
 };
\ No newline at end of file